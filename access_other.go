@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// canExecute reports whether the current user may execute path, taking the
+// owner, group and other permission classes into account, unlike checking
+// for any execute bit.
+func canExecute(path string) bool {
+	const xOK = 1
+	return syscall.Access(path, xOK) == nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readAliases parses alias definitions in the form printed by the shell's
+// alias builtin, one per line: "alias name='value'" or "name='value'".
+func readAliases(r io.Reader) (map[string]string, error) {
+	aliases := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if name, value, ok := parseAlias(scanner.Text()); ok {
+			aliases[name] = value
+		}
+	}
+	return aliases, scanner.Err()
+}
+
+// parseAlias parses one alias definition line, reporting false for lines
+// that are not one.
+func parseAlias(line string) (name, value string, ok bool) {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "alias ")
+
+	name, value, ok = strings.Cut(line, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", false
+	}
+	return name, unquote(strings.TrimSpace(value)), true
+}
+
+// unquote strips one level of shell quoting from an alias value. Bash writes
+// an embedded single quote as close-quote, escaped quote, open-quote.
+func unquote(value string) string {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return strings.ReplaceAll(value[1:len(value)-1], `'\''`, "'")
+		case value[0] == '"' && value[len(value)-1] == '"':
+			return value[1 : len(value)-1]
+		}
+	}
+	return value
+}
+
+// aliasCommand returns the command an alias value runs: its first word.
+func aliasCommand(value string) string {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+func formatAlias(name, value string) string {
+	return fmt.Sprintf("alias %s='%s'", name, strings.ReplaceAll(value, "'", `'\''`))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadAliases(t *testing.T) {
+	input := strings.Join([]string{
+		"alias ll='ls -l'",
+		`alias say='echo '\''hi'\'''`,
+		`gs="git status"`,
+		"not an alias",
+		"",
+	}, "\n")
+
+	aliases, err := readAliases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{
+		"ll":  "ls -l",
+		"say": "echo 'hi'",
+		"gs":  "git status",
+	}
+	if len(aliases) != len(expected) {
+		t.Errorf("Expected %d aliases, got %v", len(expected), aliases)
+	}
+	for name, value := range expected {
+		if aliases[name] != value {
+			t.Errorf("Alias %s = %q, expected %q", name, aliases[name], value)
+		}
+	}
+}
+
+func TestReadAliasFlag(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	testExe := filepath.Join(tmpDir, "ls")
+	if runtime.GOOS == "windows" {
+		testExe += ".exe"
+	}
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	code := run([]string{"--read-alias", "ll"}, strings.NewReader("alias ll='ls -l'\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+	if len(lines) != 2 || lines[0] != "alias ll='ls -l'" {
+		t.Fatalf("Unexpected output: %q", stdout.String())
+	}
+	if !strings.EqualFold(lines[1], "\t"+testExe) {
+		t.Errorf("Expected aliased command %s, got %q", testExe, lines[1])
+	}
+}
+
+func TestReadAliasMissingCommand(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	args := []string{"--read-alias", "--skip-dot", "--rel-to", tmpDir, "--print-checksum", "sha256", "--inode", "gone"}
+	code := run(args, strings.NewReader("alias gone='which-test-missing -x'\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if expected := "alias gone='which-test-missing -x'\n"; stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("Expected no warnings, got %q", stderr.String())
+	}
+}
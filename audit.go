@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// runAudit prints, for each name, whether it is found once (ok), not at all
+// (missing) or several times, so that the later copies are shadowed.
+func runAudit(w io.Writer, opts *options) int {
+	status := 0
+	for _, name := range opts.names {
+		matches := findAllExecutables(name, opts)
+
+		state := "ok"
+		switch {
+		case len(matches) == 0:
+			state = "missing"
+			status = opts.notFoundStatus()
+		case len(matches) > 1:
+			state = fmt.Sprintf("shadowed:%d copies", len(matches))
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", name, state); err != nil {
+			_, _ = fmt.Fprintln(opts.stderr, err)
+			return exitFailure
+		}
+	}
+	return status
+}
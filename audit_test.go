@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	dir1 := filepath.Join(tmpDir, "dir1")
+	dir2 := filepath.Join(tmpDir, "dir2")
+	files := []string{
+		filepath.Join(dir1, "git"+exe),
+		filepath.Join(dir1, "python"+exe),
+		filepath.Join(dir2, "python"+exe),
+	}
+	for _, dir := range []string{dir1, dir2} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, path := range files {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Setenv("PATH", dir1+string(os.PathListSeparator)+dir2); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("reports each name", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--audit"}, strings.NewReader("git\npython\njq\n"), &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		expected := "git\tok\npython\tshadowed:2 copies\njq\tmissing\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("all found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--stdin-names-from-path"}, strings.NewReader("git\n"), &stdout, &stderr); code != 0 {
+			t.Errorf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+	})
+}
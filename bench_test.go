@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// syntheticPath creates dirs directories holding files executables each,
+// named tool0 to tool<files-1>, and sets PATH to them for the rest of the
+// benchmark. Only the last directory has "target", so a lookup for it
+// checks every directory.
+func syntheticPath(b *testing.B, dirs, files int) {
+	b.Helper()
+
+	originalPath := os.Getenv("PATH")
+	b.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-bench")
+	if err != nil {
+		b.Fatalf("Failed to create temp dir: %v", err)
+	}
+	b.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+
+	var entries []string
+	for i := range dirs {
+		dir := filepath.Join(tmpDir, fmt.Sprintf("dir%d", i))
+		if err := os.Mkdir(dir, 0755); err != nil {
+			b.Fatalf("Failed to create dir: %v", err)
+		}
+		names := make([]string, 0, files+1)
+		for j := range files {
+			names = append(names, fmt.Sprintf("tool%d", j))
+		}
+		if i == dirs-1 {
+			names = append(names, "target")
+		}
+		for _, name := range names {
+			if err := os.WriteFile(filepath.Join(dir, name+exe), nil, 0755); err != nil {
+				b.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		entries = append(entries, dir)
+	}
+
+	if err := os.Setenv("PATH", strings.Join(entries, string(os.PathListSeparator))); err != nil {
+		b.Fatalf("Failed to set PATH: %v", err)
+	}
+}
+
+func BenchmarkFindExecutable(b *testing.B) {
+	syntheticPath(b, 50, 20)
+	opts := &options{}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if findExecutable("target", opts) == "" {
+			b.Fatal("Expected to find target")
+		}
+	}
+}
+
+func BenchmarkFindAllExecutables(b *testing.B) {
+	syntheticPath(b, 50, 20)
+	opts := &options{all: true}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if len(findAllExecutables("tool7", opts)) != 50 {
+			b.Fatal("Expected a match in every directory")
+		}
+	}
+}
+
+func BenchmarkFindMissing(b *testing.B) {
+	syntheticPath(b, 50, 20)
+	opts := &options{}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if findExecutable("missing", opts) != "" {
+			b.Fatal("Expected no match")
+		}
+	}
+}
+
+func BenchmarkGlobExecutables(b *testing.B) {
+	syntheticPath(b, 50, 20)
+	opts := &options{glob: true}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if len(globExecutables("tool1*", opts)) == 0 {
+			b.Fatal("Expected matches")
+		}
+	}
+}
+
+func BenchmarkCandidatePaths(b *testing.B) {
+	dir := filepath.Join("opt", "bin")
+	extensions := []string{".COM", ".EXE", ".BAT", ".CMD", ".VBS", ".JS", ".PS1"}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		candidatePaths(dir, "tool", extensions)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// dirCacheVersion is stored in every --cache file; a file with another
+// version is discarded and rebuilt.
+const dirCacheVersion = 1
+
+// dirCache is the --cache index: the entries of each search directory,
+// stamped with the directory's modification time. A lookup skips a
+// directory whose entries cannot contain any candidate for the name, which
+// saves a stat per candidate and PATHEXT extension. Matches are still
+// checked on disk, so the index only needs to know which names exist, and
+// adding, removing or renaming a file changes the directory's modification
+// time and invalidates its entry.
+type dirCache struct {
+	mu    sync.Mutex
+	dirs  map[string]*cachedDir
+	dirty bool
+}
+
+// cachedDir is the index of one directory. names holds the lowercased
+// entries, built on first use and checked against the directory's current
+// modification time at most once per run.
+type cachedDir struct {
+	ModTime int64    `json:"mtime"`
+	Entries []string `json:"entries"`
+
+	names map[string]bool
+}
+
+// dirCacheFile is the on-disk form of a dirCache.
+type dirCacheFile struct {
+	Version int                   `json:"version"`
+	Dirs    map[string]*cachedDir `json:"dirs"`
+}
+
+// loadDirCache reads the --cache file at path. A missing file gives an
+// empty cache; an unreadable or corrupt one gives an empty cache and an
+// error, so the lookup falls back to scanning and the file is rewritten.
+func loadDirCache(path string) (*dirCache, error) {
+	c := &dirCache{dirs: make(map[string]*cachedDir)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, fmt.Errorf("reading cache: %w", err)
+	}
+
+	var file dirCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		c.dirty = true
+		return c, fmt.Errorf("reading cache %s: %w", path, err)
+	}
+	if file.Version != dirCacheVersion {
+		c.dirty = true
+		return c, nil
+	}
+	for dir, entry := range file.Dirs {
+		if entry != nil {
+			c.dirs[dir] = entry
+		}
+	}
+	return c, nil
+}
+
+// save writes the cache to path if any directory was scanned in this run.
+// The file is replaced by a rename, so a concurrent invocation reads either
+// the old or the new index, never a partial one.
+func (c *dirCache) save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(dirCacheFile{Version: dirCacheVersion, Dirs: c.dirs})
+	if err != nil {
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+// names returns the lowercased entries of dir, from the index while its
+// modification time is unchanged and read from disk otherwise. It returns
+// false if dir cannot be read, leaving the lookup to find nothing there on
+// its own.
+func (c *dirCache) names(dir string) (map[string]bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := c.dirs[dir]
+	if entry != nil && entry.names != nil {
+		return entry.names, true
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, false
+	}
+	mtime := info.ModTime().UnixNano()
+	if entry == nil || entry.ModTime != mtime {
+		dirEntries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, false
+		}
+		entry = &cachedDir{ModTime: mtime}
+		for _, e := range dirEntries {
+			entry.Entries = append(entry.Entries, e.Name())
+		}
+		c.dirs[dir] = entry
+		c.dirty = true
+	}
+
+	entry.names = make(map[string]bool, len(entry.Entries))
+	for _, name := range entry.Entries {
+		entry.names[strings.ToLower(name)] = true
+	}
+	return entry.names, true
+}
+
+// mayContain reports whether dir may hold a match for name, that is,
+// whether any file findInDir would check there exists. Names are compared
+// case-insensitively, which only ever lets more directories through.
+func (c *dirCache) mayContain(dir, name string, opts *options) bool {
+	names, ok := c.names(dir)
+	if !ok {
+		return true
+	}
+
+	forms := []string{name}
+	if opts.unicodeNormalize {
+		forms = normalizationForms(name)
+	}
+	for _, form := range forms {
+		for _, path := range dirCandidates(dir, form, opts) {
+			if names[strings.ToLower(filepath.Base(path))] {
+				return true
+			}
+		}
+		if opts.followLnk && runtime.GOOS == "windows" && names[strings.ToLower(form+".lnk")] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDirCache(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+
+	bin := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	prog := filepath.Join(bin, "prog"+exe)
+	if err := os.WriteFile(prog, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", bin); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	cache := filepath.Join(tmpDir, "which.json")
+	lookup := func(t *testing.T, name string, extra ...string) (string, string, int) {
+		t.Helper()
+		var stdout, stderr strings.Builder
+		args := append([]string{"--skip-dot", "--cache", cache}, extra...)
+		code := run(append(args, name), nil, &stdout, &stderr)
+		return stdout.String(), stderr.String(), code
+	}
+	readCache := func(t *testing.T) dirCacheFile {
+		t.Helper()
+		data, err := os.ReadFile(cache)
+		if err != nil {
+			t.Fatalf("Failed to read cache: %v", err)
+		}
+		var file dirCacheFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatalf("Failed to parse cache: %v", err)
+		}
+		return file
+	}
+	writeCache := func(t *testing.T, file dirCacheFile) {
+		t.Helper()
+		data, err := json.Marshal(file)
+		if err != nil {
+			t.Fatalf("Failed to encode cache: %v", err)
+		}
+		if err := os.WriteFile(cache, data, 0644); err != nil {
+			t.Fatalf("Failed to write cache: %v", err)
+		}
+	}
+
+	t.Run("miss writes the index", func(t *testing.T) {
+		if stdout, stderr, code := lookup(t, "prog"); code != 0 || stdout != prog+"\n" {
+			t.Fatalf("Expected %s, got %q (exit %d, stderr: %s)", prog, stdout, code, stderr)
+		}
+		file := readCache(t)
+		if file.Dirs[bin] == nil || len(file.Dirs[bin].Entries) != 1 {
+			t.Errorf("Expected an index of %s, got %+v", bin, file.Dirs)
+		}
+	})
+
+	t.Run("hit uses the index", func(t *testing.T) {
+		// Drop prog from an otherwise current index: a lookup that trusts
+		// it skips the directory.
+		file := readCache(t)
+		file.Dirs[bin].Entries = nil
+		writeCache(t, file)
+
+		if stdout, _, code := lookup(t, "prog"); code != exitNotFound {
+			t.Errorf("Expected the cached index to be used, got %q (exit %d)", stdout, code)
+		}
+	})
+
+	t.Run("stale directory is rescanned", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(bin, later, later); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+		if stdout, stderr, code := lookup(t, "prog"); code != 0 || stdout != prog+"\n" {
+			t.Fatalf("Expected %s, got %q (exit %d, stderr: %s)", prog, stdout, code, stderr)
+		}
+		if entry := readCache(t).Dirs[bin]; entry == nil || entry.ModTime != later.UnixNano() || len(entry.Entries) != 1 {
+			t.Errorf("Expected the index of %s to be refreshed, got %+v", bin, entry)
+		}
+	})
+
+	t.Run("corrupt cache falls back to scanning", func(t *testing.T) {
+		if err := os.WriteFile(cache, []byte("{not json"), 0644); err != nil {
+			t.Fatalf("Failed to write cache: %v", err)
+		}
+		stdout, stderr, code := lookup(t, "prog", "-v")
+		if code != 0 || stdout != prog+"\n" {
+			t.Fatalf("Expected %s, got %q (exit %d, stderr: %s)", prog, stdout, code, stderr)
+		}
+		if !strings.Contains(stderr, "rebuilding it") {
+			t.Errorf("Expected a warning about the corrupt cache, got %q", stderr)
+		}
+		if readCache(t).Dirs[bin] == nil {
+			t.Error("Expected the cache to be rewritten")
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// checkAssert compares the path found for name with the --assert value,
+// applying the same normalization and resolution to both sides. On mismatch
+// it writes a short diff to w and returns false.
+func checkAssert(w io.Writer, name, path string, opts *options) bool {
+	actual := comparablePath(path, opts)
+	expected := comparablePath(opts.assert, opts)
+
+	if sameDir(actual, expected) {
+		return true
+	}
+
+	_, _ = fmt.Fprintf(w, "assertion failed for %s:\n", name)
+	_, _ = fmt.Fprintf(w, "  expected: %s\n", expected)
+	_, _ = fmt.Fprintf(w, "  actual:   %s\n", actual)
+	return false
+}
+
+// checkCanonical reports whether path, found for name, is already canonical:
+// equal to its form with every symlink resolved. Otherwise it writes both
+// forms to w and returns false.
+func checkCanonical(w io.Writer, name, path string) bool {
+	canonical, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		_, _ = fmt.Fprintf(w, "cannot resolve %s: %v\n", path, err)
+		return false
+	}
+	if canonical == path {
+		return true
+	}
+
+	_, _ = fmt.Fprintf(w, "%s is not canonical:\n", name)
+	_, _ = fmt.Fprintf(w, "  found:     %s\n", path)
+	_, _ = fmt.Fprintf(w, "  canonical: %s\n", canonical)
+	return false
+}
+
+// checkRequireDir reports whether the match r found for name lies in one of
+// the --require-dir directories, and with --resolve whether its target does
+// too. Otherwise it names the unexpected directory on w and returns false.
+func checkRequireDir(w io.Writer, name string, r result, opts *options) bool {
+	var approved []string
+	for _, dir := range opts.requireDirs {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		approved = append(approved, resultPath(dir, opts))
+	}
+
+	for _, path := range []string{r.Path, r.Resolved} {
+		if path == "" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if !containsDir(approved, dir) {
+			_, _ = fmt.Fprintf(w, "%s found in %s, which is not a required directory\n", name, dir)
+			return false
+		}
+	}
+	return true
+}
+
+// comparablePath puts path in the form that is printed for it, so two paths
+// reaching the same file through different spellings compare equal.
+func comparablePath(path string, opts *options) string {
+	path = resultPath(filepath.Clean(path), opts)
+	if opts.resolve {
+		if target, err := filepath.EvalSymlinks(path); err == nil {
+			path = target
+		}
+	}
+	return path
+}
+
+// runMinDirs checks that each name is found in at least opts.minDirs
+// distinct search directories, for spotting missing redundancy or
+// unexpected duplicates. The directories of a name that passes are printed;
+// those of a name that fails only with --verbose.
+func runMinDirs(stdout io.Writer, opts *options) int {
+	status := 0
+	for _, name := range opts.names {
+		var dirs []string
+		for _, path := range findAllExecutables(name, opts) {
+			if dir := filepath.Dir(path); !containsDir(dirs, dir) {
+				dirs = append(dirs, dir)
+			}
+		}
+
+		w := stdout
+		if len(dirs) < opts.minDirs {
+			status = exitFailure
+			if !opts.verbose {
+				continue
+			}
+			w = opts.stderr
+			_, _ = fmt.Fprintf(w, "%s: found in %d of %d required directories\n", name, len(dirs), opts.minDirs)
+		}
+		for _, dir := range dirs {
+			if _, err := fmt.Fprintln(w, dir); err != nil {
+				return exitFailure
+			}
+		}
+	}
+	return status
+}
+
+// pathEntry is one PATH entry in the --list-path report.
+type pathEntry struct {
+	Dir    string `json:"dir"`
+	Status string `json:"status"` // "ok", "missing", "not-a-dir" or "unreadable"
+}
+
+// runListPath reports, for every PATH entry in order, whether it is a
+// directory that can be listed.
+func runListPath(w io.Writer, opts *options) int {
+	path, _ := pathEnv(opts)
+
+	entries := []pathEntry{}
+	for _, dir := range filepath.SplitList(path) {
+		entries = append(entries, pathEntry{dir, dirStatus(cmp.Or(dir, "."))})
+	}
+
+	var err error
+	if opts.format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	} else {
+		for _, e := range entries {
+			if _, err = fmt.Fprintf(w, "%s\t%s\n", e.Dir, e.Status); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(opts.stderr, err)
+		return exitFailure
+	}
+	return 0
+}
+
+func dirStatus(dir string) string {
+	info, err := os.Stat(dir)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "missing"
+	case err != nil:
+		return "unreadable"
+	case !info.IsDir():
+		return "not-a-dir"
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return "unreadable"
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+		return "unreadable"
+	}
+	return "ok"
+}
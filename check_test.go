@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAssert(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir1, err := os.MkdirTemp("", "which-test1")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir1) })
+
+	tmpDir2, err := os.MkdirTemp("", "which-test2")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir2) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir1); err == nil {
+			tmpDir1 = resolved
+		}
+		if resolved, err := filepath.EvalSymlinks(tmpDir2); err == nil {
+			tmpDir2 = resolved
+		}
+	}
+
+	exeName := "python"
+	if runtime.GOOS == "windows" {
+		exeName = "python.exe"
+	}
+	shim := filepath.Join(tmpDir1, exeName)
+	realExe := filepath.Join(tmpDir2, exeName)
+	for _, exe := range []string{shim, realExe} {
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir1+string(os.PathListSeparator)+tmpDir2); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("matching expected path exits 0", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--assert=" + shim, "python"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Errorf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+	})
+
+	t.Run("mismatching expected path fails with a diff", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--assert", realExe, "python"}, nil, &stdout, &stderr)
+		if code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if !strings.Contains(stderr.String(), "expected: "+realExe) {
+			t.Errorf("Expected diff to name the expected path, got %q", stderr.String())
+		}
+		if !strings.Contains(stderr.String(), "actual:   "+shim) {
+			t.Errorf("Expected diff to name the actual path, got %q", stderr.String())
+		}
+	})
+
+	t.Run("compares after resolution", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("Symlinks require elevated privileges on Windows")
+		}
+
+		linkDir, err := os.MkdirTemp("", "which-test-link")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(linkDir) })
+
+		if err := os.Symlink(realExe, filepath.Join(linkDir, "python")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if err := os.Setenv("PATH", linkDir); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		t.Cleanup(func() { _ = os.Setenv("PATH", tmpDir1+string(os.PathListSeparator)+tmpDir2) })
+
+		resolvedReal, err := filepath.EvalSymlinks(realExe)
+		if err != nil {
+			t.Fatalf("Failed to resolve %s: %v", realExe, err)
+		}
+
+		var stdout, stderr strings.Builder
+		code := run([]string{"--resolve", "--assert", resolvedReal, "python"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Errorf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+	})
+}
+
+func TestMinDirs(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "python"+exe), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(first, "single"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", strings.Join([]string{first, second}, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("at threshold", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--min-dirs=2", "python"}, nil, &stdout, &stderr); code != 0 {
+			t.Errorf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := first + "\n" + second + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("below threshold", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--min-dirs=2", "single"}, nil, &stdout, &stderr); code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if stdout.String() != "" || stderr.String() != "" {
+			t.Errorf("Expected no output, got %q and %q", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("below threshold verbose", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--min-dirs=2", "-v", "single"}, nil, &stdout, &stderr); code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if !strings.Contains(stderr.String(), "single: found in 1 of 2 required directories") {
+			t.Errorf("Expected a threshold message, got %q", stderr.String())
+		}
+	})
+}
+
+func TestListPath(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	missing := filepath.Join(tmpDir, "missing")
+	file := filepath.Join(tmpDir, "file")
+	if err := os.WriteFile(file, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	list := strings.Join([]string{tmpDir, missing, file}, string(os.PathListSeparator))
+
+	t.Run("plain", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--list-path", "--path", list}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := tmpDir + "\tok\n" + missing + "\tmissing\n" + file + "\tnot-a-dir\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--list-path", "--format", "json", "--path", list}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		var entries []pathEntry
+		if err := json.Unmarshal([]byte(stdout.String()), &entries); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		expected := []pathEntry{{tmpDir, "ok"}, {missing, "missing"}, {file, "not-a-dir"}}
+		if !slices.Equal(entries, expected) {
+			t.Errorf("Expected %v, got %v", expected, entries)
+		}
+	})
+
+	t.Run("json empty", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--list-path", "--format", "json", "--path", ""}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stdout.String() != "[]\n" {
+			t.Errorf("Expected an empty array, got %q", stdout.String())
+		}
+	})
+
+	t.Run("unreadable", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("Directory permissions are not modeled by mode bits on Windows")
+		}
+		if os.Geteuid() == 0 {
+			t.Skip("root may read any directory")
+		}
+		locked := filepath.Join(tmpDir, "locked")
+		if err := os.Mkdir(locked, 0); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		t.Cleanup(func() { _ = os.Chmod(locked, 0755) })
+		if status := dirStatus(locked); status != "unreadable" {
+			t.Errorf("Expected unreadable, got %s", status)
+		}
+	})
+}
+
+func TestRealpathOnly(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	testExe := filepath.Join(tmpDir, "node"+exe)
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("canonical path", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--realpath-only", "node"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if result := strings.TrimSpace(stdout.String()); result != testExe {
+			t.Errorf("Expected %s, got %s", testExe, result)
+		}
+	})
+
+	t.Run("symlinked path", func(t *testing.T) {
+		link := filepath.Join(tmpDir, "nodejs"+exe)
+		if err := os.Symlink(testExe, link); err != nil {
+			t.Skipf("Cannot create symlink (requires privilege or developer mode on Windows): %v", err)
+		}
+
+		// Windows matches are normalized through symlinks unless
+		// --no-normalize is given.
+		var stdout, stderr strings.Builder
+		code := run([]string{"--realpath-only", "--no-normalize", "nodejs"}, nil, &stdout, &stderr)
+		if code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if stdout.String() != "" {
+			t.Errorf("Expected no output, got %q", stdout.String())
+		}
+		for _, expected := range []string{"nodejs is not canonical", "found:     " + link, "canonical: " + testExe} {
+			if !strings.Contains(stderr.String(), expected) {
+				t.Errorf("Expected %q in stderr, got %q", expected, stderr.String())
+			}
+		}
+	})
+}
+
+func TestRequireDir(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	localDir := filepath.Join(tmpDir, "local")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{localDir, binDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "docker"+exe), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	pathList := strings.Join([]string{localDir, binDir}, string(os.PathListSeparator))
+	if err := os.Setenv("PATH", pathList); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("approved directory", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--require-dir", binDir, "--require-dir", localDir, "docker"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := filepath.Join(localDir, "docker"+exe)
+		if result := strings.TrimSpace(stdout.String()); !strings.EqualFold(result, expected) {
+			t.Errorf("Expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("unapproved directory", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--require-dir", binDir, "docker"}, nil, &stdout, &stderr)
+		if code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if stdout.String() != "" {
+			t.Errorf("Expected no output, got %q", stdout.String())
+		}
+		expected := "docker found in " + localDir + ", which is not a required directory\n"
+		if !strings.EqualFold(stderr.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+}
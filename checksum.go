@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+)
+
+var checksumAlgorithms = []string{"sha256", "sha1", "md5"}
+
+// fileChecksum returns the digest of the file at path as "algorithm:hex",
+// e.g. "sha256:9f86d0...". The file is streamed through the hash, so its
+// size does not matter.
+func fileChecksum(path, algorithm string) (string, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha1":
+		h = sha1.New()
+	case "md5":
+		h = md5.New()
+	default:
+		h = sha256.New()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+)
+
+// direnvCommand is the direnv executable --from-direnv runs.
+var direnvCommand = "direnv"
+
+// applyDirenv loads PATH and PATHEXT from "direnv export json" into opts,
+// leaving values given with --path, --pathext or --env-file alone. direnv
+// prints only the variables its .envrc changes, and nothing when the
+// environment is already up to date, so an empty export keeps the ambient
+// PATH.
+func applyDirenv(opts *options) error {
+	exe, err := exec.LookPath(direnvCommand)
+	if err != nil {
+		return fmt.Errorf("direnv is not installed")
+	}
+
+	out, err := exec.Command(exe, "export", "json").Output()
+	if err != nil {
+		return fmt.Errorf("direnv export json: %w", err)
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil
+	}
+
+	// Variables the .envrc unsets are exported as null.
+	var env map[string]*string
+	if err := json.Unmarshal(out, &env); err != nil {
+		return fmt.Errorf("direnv export json: %w", err)
+	}
+
+	for key, value := range env {
+		if value == nil {
+			continue
+		}
+		switch {
+		case envKey(key, "PATH") && opts.path == nil:
+			opts.path = value
+		case envKey(key, "PATHEXT") && opts.pathext == nil:
+			opts.pathext = value
+		}
+	}
+	return nil
+}
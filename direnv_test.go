@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestFromDirenv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake direnv is a shell script")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	originalCommand := direnvCommand
+	t.Cleanup(func() { direnvCommand = originalCommand })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	projectBin := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(projectBin, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	testExe := filepath.Join(projectBin, "projtool")
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	fakeDirenv := filepath.Join(tmpDir, "direnv")
+	script := "#!/bin/sh\necho '{\"PATH\": \"" + projectBin + "\", \"GOFLAGS\": null}'\n"
+	if err := os.WriteFile(fakeDirenv, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create fake direnv: %v", err)
+	}
+
+	if err := os.Setenv("PATH", filepath.Join(tmpDir, "empty")); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("uses the exported PATH", func(t *testing.T) {
+		direnvCommand = fakeDirenv
+		var stdout, stderr strings.Builder
+		code := run([]string{"--from-direnv", "projtool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if result := strings.TrimSpace(stdout.String()); result != testExe {
+			t.Errorf("Expected %s, got %s", testExe, result)
+		}
+	})
+
+	t.Run("--path takes precedence", func(t *testing.T) {
+		direnvCommand = fakeDirenv
+		var stdout, stderr strings.Builder
+		code := run([]string{"--from-direnv", "--path", tmpDir, "projtool"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+	})
+
+	t.Run("falls back without direnv", func(t *testing.T) {
+		direnvCommand = filepath.Join(tmpDir, "missing")
+		if err := os.Setenv("PATH", projectBin); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		var stdout, stderr strings.Builder
+		code := run([]string{"--from-direnv", "projtool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if result := strings.TrimSpace(stdout.String()); result != testExe {
+			t.Errorf("Expected %s, got %s", testExe, result)
+		}
+		if !strings.Contains(stderr.String(), "direnv is not installed") {
+			t.Errorf("Expected a warning about direnv, got %q", stderr.String())
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// readEnvFile parses a dotenv file: KEY=VALUE lines, optionally prefixed
+// with "export" and with the value in single or double quotes. Blank lines
+// and lines starting with # are ignored.
+func readEnvFile(r io.Reader) (map[string]string, error) {
+	env := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			continue
+		}
+		env[key] = unquote(strings.TrimSpace(value))
+	}
+	return env, scanner.Err()
+}
+
+// applyEnvFile loads PATH and PATHEXT from the --env-file file into opts,
+// leaving values given with --path and --pathext alone. Variable names are
+// case-insensitive on Windows, as in the environment.
+func applyEnvFile(opts *options) error {
+	f, err := os.Open(opts.envFile)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	env, err := readEnvFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", opts.envFile, err)
+	}
+
+	for key, value := range env {
+		switch {
+		case envKey(key, "PATH") && opts.path == nil:
+			opts.path = &value
+		case envKey(key, "PATHEXT") && opts.pathext == nil:
+			opts.pathext = &value
+		}
+	}
+	return nil
+}
+
+func envKey(key, name string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(key, name)
+	}
+	return key == name
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadEnvFile(t *testing.T) {
+	input := `# service environment
+PATH=/opt/service/bin:/usr/bin
+export PATHEXT='.EXE;.CMD'
+HOME="/var/lib/service"
+
+not a variable
+`
+	env, err := readEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to read env file: %v", err)
+	}
+
+	expected := map[string]string{
+		"PATH":    "/opt/service/bin:/usr/bin",
+		"PATHEXT": ".EXE;.CMD",
+		"HOME":    "/var/lib/service",
+	}
+	if len(env) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, env)
+	}
+	for key, value := range expected {
+		if env[key] != value {
+			t.Errorf("Expected %s=%s, got %q", key, value, env[key])
+		}
+	}
+}
+
+func TestEnvFile(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exeName := "mytool"
+	if runtime.GOOS == "windows" {
+		exeName = "mytool.exe"
+	}
+	serviceDir := filepath.Join(tmpDir, "service")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{serviceDir, otherDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, exeName), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	envFile := filepath.Join(tmpDir, "service.env")
+	if err := os.WriteFile(envFile, []byte("export PATH="+serviceDir+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create env file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", otherDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("PATH from the env file", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--env-file", envFile, "mytool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := filepath.Join(serviceDir, exeName)
+		if !strings.EqualFold(strings.TrimSpace(stdout.String()), expected) {
+			t.Errorf("Expected %s, got %s", expected, stdout.String())
+		}
+	})
+
+	t.Run("--path wins over the env file", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--env-file", envFile, "--path", otherDir, "mytool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := filepath.Join(otherDir, exeName)
+		if !strings.EqualFold(strings.TrimSpace(stdout.String()), expected) {
+			t.Errorf("Expected %s, got %s", expected, stdout.String())
+		}
+	})
+
+	t.Run("missing env file", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--env-file", filepath.Join(tmpDir, "missing.env"), "mytool"}, nil, &stdout, &stderr); code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if !strings.Contains(stderr.String(), "reading env file") {
+			t.Errorf("Expected an env file error, got %q", stderr.String())
+		}
+	})
+}
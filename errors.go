@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Reasons a name was not found, reported in JSON output.
+var (
+	errNotOnPath     = errors.New("not on PATH")
+	errNotExecutable = errors.New("not executable")
+	errIsDirectory   = errors.New("is a directory")
+	errForeignPath   = errors.New("looks like a Windows path; not valid on this OS")
+
+	errPermissionDenied = errors.New("permission denied")
+
+	errBrokenAlternatives = errors.New("broken alternatives link")
+
+	errSymlinkLoop = errors.New("too many levels of symbolic links")
+
+	errScriptSkipped = errors.New("a script, skipped by --binary-only")
+)
+
+// alternativesDir is where Debian's update-alternatives keeps the links
+// that commands such as editor are routed through.
+var alternativesDir = "/etc/alternatives"
+
+// reasonCode maps a not-found error to its stable JSON reason.
+func reasonCode(err error) string {
+	switch {
+	case errors.Is(err, errNotExecutable):
+		return "not_executable"
+	case errors.Is(err, errIsDirectory):
+		return "is_directory"
+	case errors.Is(err, errForeignPath):
+		return "foreign_path"
+	case errors.Is(err, errPermissionDenied):
+		return "permission_denied"
+	case errors.Is(err, errBrokenAlternatives):
+		return "broken_alternatives"
+	case errors.Is(err, errSymlinkLoop):
+		return "symlink_loop"
+	case errors.Is(err, errScriptSkipped):
+		return "script_skipped"
+	default:
+		return "not_on_path"
+	}
+}
+
+// notFoundReason explains why name has no match by checking the candidate
+// paths again: the first one that exists but is a directory, lacks execute
+// permission, or has it but not for the current user, or is a script that
+// --binary-only skips determines the reason, as do a symlink cycle and a
+// dangling link into alternativesDir. A Windows path on another OS is
+// reported as such, since it was most likely pasted from the wrong system.
+func notFoundReason(name string, opts *options) error {
+	if runtime.GOOS != "windows" && isWindowsPath(name) {
+		return errForeignPath
+	}
+	for _, path := range allCandidatePaths(name, opts) {
+		info, err := statRetry(path, opts.retry, os.Stat)
+		if err != nil {
+			if isLinkLoop(err) {
+				return fmt.Errorf("%s: %w", path, errSymlinkLoop)
+			}
+			if broken := brokenAlternatives(path); broken != nil {
+				return broken
+			}
+			continue
+		}
+		if info.IsDir() {
+			return errIsDirectory
+		}
+		if info.Mode()&0111 != 0 && !canExecute(path) {
+			return fmt.Errorf("found %s but %w", path, errPermissionDenied)
+		}
+		if opts.binaryOnly && isExecutable(path, opts) && isScript(path) {
+			return fmt.Errorf("found %s, %w", path, errScriptSkipped)
+		}
+		return errNotExecutable
+	}
+	return errNotOnPath
+}
+
+// isLinkLoop reports whether err is one of linkLoopErrors, the system's
+// errors for a cycle of symbolic links.
+func isLinkLoop(err error) bool {
+	for _, loop := range linkLoopErrors {
+		if errors.Is(err, loop) {
+			return true
+		}
+	}
+	return false
+}
+
+// brokenAlternatives reports a dangling symlink chain at path that runs
+// through alternativesDir, naming the alternatives link and the missing
+// file it points to, or nil for any other path.
+func brokenAlternatives(path string) error {
+	hops := traceLinks(path)
+	last := hops[len(hops)-1]
+	if last.Status != "missing" {
+		return nil
+	}
+	if filepath.Dir(last.Path) == alternativesDir {
+		return fmt.Errorf("%w: %s -> (missing)", errBrokenAlternatives, last.Path)
+	}
+	if len(hops) > 1 && filepath.Dir(hops[len(hops)-2].Path) == alternativesDir {
+		return fmt.Errorf("%w: %s -> %s (missing)", errBrokenAlternatives, hops[len(hops)-2].Path, last.Path)
+	}
+	return nil
+}
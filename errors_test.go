@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNotFoundReason(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if err := os.Mkdir(filepath.Join(tmpDir, "subdir"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "plain"), []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	exeName := "tool"
+	if runtime.GOOS == "windows" {
+		exeName = "tool.exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, exeName), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		unixOnly bool
+	}{
+		{"missing", "nonexistent", "not_on_path", false},
+		{"directory", "subdir", "is_directory", true},
+		{"not executable", "plain", "not_executable", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unixOnly && runtime.GOOS == "windows" {
+				t.Skip("Windows only considers names with PATHEXT extensions")
+			}
+			result := reasonCode(notFoundReason(tt.input, &options{}))
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("JSON includes the reason only for missing names", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--format", "json", "tool", "nonexistent"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+
+		var results []map[string]any
+		if err := json.Unmarshal([]byte(stdout.String()), &results); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", stdout.String(), err)
+		}
+		if len(results) != 2 {
+			t.Fatalf("Expected 2 results, got %v", results)
+		}
+		if _, ok := results[0]["reason"]; ok {
+			t.Errorf("Expected no reason for a found name, got %v", results[0])
+		}
+		if results[1]["reason"] != "not_on_path" {
+			t.Errorf("Expected not_on_path reason, got %v", results[1])
+		}
+	})
+}
+
+func TestIsWindowsPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`C:\foo\bar`, true},
+		{`c:/foo/bar`, true},
+		{`\\server\share\tool.exe`, true},
+		{"/usr/bin/ls", false},
+		{"C:", false},
+		{"1:/foo", false},
+		{`foo\bar`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := isWindowsPath(tt.input); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestForeignPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows paths are native on Windows")
+	}
+
+	t.Run("Windows path on Unix", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--format", "json", `C:\foo\bar`}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if !strings.Contains(stderr.String(), "looks like a Windows path; not valid on this OS") {
+			t.Errorf("Expected a Windows path hint, got %q", stderr.String())
+		}
+		if !strings.Contains(stdout.String(), `"reason": "foreign_path"`) {
+			t.Errorf("Expected reason foreign_path, got %s", stdout.String())
+		}
+	})
+
+	t.Run("Unix absolute path", func(t *testing.T) {
+		tmpDir, err := os.MkdirTemp("", "which-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+		exe := filepath.Join(tmpDir, "tool")
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		var stdout, stderr strings.Builder
+		if code := run([]string{exe}, nil, &stdout, &stderr); code != 0 {
+			t.Errorf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stdout.String() != exe+"\n" {
+			t.Errorf("Expected %s, got %q", exe, stdout.String())
+		}
+	})
+}
+
+func TestPermissionDenied(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no execute permission bits")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("root may execute any file with an execute bit")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	// Only others may execute it; the owner may not.
+	exe := filepath.Join(tmpDir, "restricted")
+	if err := os.WriteFile(exe, []byte("test"), 0601); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	code := run([]string{"--format", "json", "restricted"}, nil, &stdout, &stderr)
+	if code != exitPermissionDenied {
+		t.Errorf("Expected exit code %d, got %d", exitPermissionDenied, code)
+	}
+	expected := "restricted: found " + exe + " but permission denied\n"
+	if stderr.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"reason": "permission_denied"`) {
+		t.Errorf("Expected reason permission_denied, got %s", stdout.String())
+	}
+}
+
+func TestBrokenAlternatives(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	binDir := filepath.Join(tmpDir, "bin")
+	altDir := filepath.Join(tmpDir, "alternatives")
+	for _, dir := range []string{binDir, altDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	originalAlternatives := alternativesDir
+	t.Cleanup(func() { alternativesDir = originalAlternatives })
+	alternativesDir = altDir
+
+	// editor -> alternatives/editor -> vim.basic, which was removed;
+	// pager -> alternatives/pager, which was removed itself.
+	vim := filepath.Join(tmpDir, "vim.basic")
+	links := [][2]string{
+		{filepath.Join(altDir, "editor"), vim},
+		{filepath.Join(binDir, "editor"), filepath.Join(altDir, "editor")},
+		{filepath.Join(binDir, "pager"), filepath.Join(altDir, "pager")},
+		{filepath.Join(binDir, "dangling"), filepath.Join(tmpDir, "missing")},
+	}
+	for _, link := range links {
+		if err := os.Symlink(link[1], link[0]); err != nil {
+			t.Skipf("Cannot create symlink: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"editor", "editor: broken alternatives link: " + filepath.Join(altDir, "editor") + " -> " + vim + " (missing)\n"},
+		{"pager", "pager: broken alternatives link: " + filepath.Join(altDir, "pager") + " -> (missing)\n"},
+		{"dangling", "dangling not found in PATH\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			code := run([]string{"--format", "json", tt.name}, nil, &stdout, &stderr)
+			if code != exitNotFound {
+				t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+			}
+			if stderr.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stderr.String())
+			}
+		})
+	}
+
+	t.Run("reason", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		run([]string{"--format", "json", "editor"}, nil, &stdout, &stderr)
+		if !strings.Contains(stdout.String(), `"reason": "broken_alternatives"`) {
+			t.Errorf("Expected reason broken_alternatives, got %s", stdout.String())
+		}
+	})
+}
+
+func TestSymlinkLoop(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	first := filepath.Join(tmpDir, "loop"+exe)
+	second := filepath.Join(tmpDir, "other"+exe)
+	if err := os.Symlink(second, first); err != nil {
+		t.Skipf("Cannot create symlink (requires privilege or developer mode on Windows): %v", err)
+	}
+	if err := os.Symlink(first, second); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	code := run([]string{"--format", "json", "loop"}, nil, &stdout, &stderr)
+	if code != exitSymlinkLoop {
+		t.Errorf("Expected exit code %d, got %d (stderr: %s)", exitSymlinkLoop, code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "too many levels of symbolic links") {
+		t.Errorf("Expected a symlink loop message, got %q", stderr.String())
+	}
+
+	var results []result
+	if err := json.Unmarshal([]byte(stdout.String()), &results); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(results) != 1 || results[0].Reason != "symlink_loop" {
+		t.Errorf("Expected reason symlink_loop, got %+v", results)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runExplain prints a narrative of the lookup of each name: where the search
+// directories come from, every candidate file tried and what was wrong with
+// it, and the result. It stops at the first match unless --all is given.
+func runExplain(w io.Writer, opts *options) int {
+	status := 0
+	for i, name := range opts.names {
+		if i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+		if !explainName(w, name, opts) {
+			status = opts.notFoundStatus()
+		}
+	}
+	return status
+}
+
+func explainName(w io.Writer, name string, opts *options) bool {
+	say := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(w, format+"\n", args...)
+	}
+
+	say("Looking up %s.", name)
+	if extensions := getExtensions(opts); len(extensions) > 0 {
+		say("PATHEXT gives %d extensions: %s.", len(extensions), strings.Join(extensions, " "))
+	}
+
+	var found []string
+	if isPath(name) {
+		say("%s contains a path separator, so PATH is not searched.", name)
+		if path, ok := explainDir(w, filepath.Dir(name), filepath.Base(name), opts); ok {
+			found = append(found, path)
+		}
+	} else {
+		explainSearchDirs(w, opts)
+		walkSearchDirs(opts, func(root, dir string) bool {
+			path, ok := explainDir(w, dir, name, opts)
+			if ok {
+				found = append(found, path)
+			}
+			return ok && !opts.all
+		})
+	}
+
+	switch len(found) {
+	case 0:
+		say("Result: %s not found.", name)
+		return false
+	case 1:
+		say("Result: %s.", found[0])
+	default:
+		say("Result: %d matches, %s wins.", len(found), found[0])
+	}
+	return true
+}
+
+// explainSearchDirs describes where the search directories come from.
+func explainSearchDirs(w io.Writer, opts *options) {
+	say := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(w, format+"\n", args...)
+	}
+
+	if opts.dir != "" {
+		say("Searching only %s (--dir).", opts.dir)
+		return
+	}
+
+	path, isDefault := pathEnv(opts)
+	switch {
+	case isDefault:
+		say("PATH is unset, using the default %s.", path)
+	case path == "":
+		say("PATH is empty.")
+	}
+
+	dirs := searchDirs(opts)
+	entries := len(filepath.SplitList(path))
+	say("PATH has %d entries, %d of them searched.", entries, len(dirs))
+	if searchesCwd(opts) {
+		if cwd, err := os.Getwd(); err == nil {
+			say("On Windows, the current directory %s is searched first.", cwd)
+		}
+	}
+	if opts.maxDepth > 0 {
+		say("Subdirectories are searched up to %d levels deep.", opts.maxDepth)
+	}
+}
+
+// verdictNotes describes each verdict of checkCandidates for explain.
+var verdictNotes = map[verdict]string{
+	verdictMissing:       "not found",
+	verdictDir:           "a directory, skipped",
+	verdictNotExecutable: "not executable, skipped",
+	verdictScript:        "a script, skipped (--binary-only)",
+	verdictExtCase:       "extension spelled differently, skipped (--ext-case-sensitive)",
+	verdictFound:         "found, executable",
+	verdictFoundNoexec:   "found, not executable but accepted (--allow-noexec-ext)",
+	verdictNotShortcut:   "not a shortcut to a program, skipped",
+	verdictShortcut:      "found, a shortcut to a program (--follow-lnk)",
+}
+
+// explainDir tries the candidates for name in dir with the same check as
+// findInDir, describing each one, and returns the match if there is one.
+func explainDir(w io.Writer, dir, name string, opts *options) (string, bool) {
+	path := checkCandidates(dir, name, opts, func(path string, v verdict) {
+		_, _ = fmt.Fprintf(w, "Trying %s... %s.\n", path, verdictNotes[v])
+	})
+	return path, path != ""
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+
+	dir1 := filepath.Join(tmpDir, "dir1")
+	dir2 := filepath.Join(tmpDir, "dir2")
+	for _, dir := range []string{dir1, dir2} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	prog := filepath.Join(dir2, "prog"+exe)
+	if err := os.WriteFile(prog, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+	_ = os.Setenv("PATH", dir1+string(os.PathListSeparator)+dir2)
+
+	t.Run("found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"explain", "prog"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		out := stdout.String()
+		for _, want := range []string{
+			"Looking up prog.",
+			"PATH has 2 entries",
+			"Trying " + filepath.Join(dir1, "prog"),
+			"Trying " + prog + "... found, executable.",
+			"Result: " + prog + ".",
+		} {
+			if !strings.Contains(out, want) {
+				t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"explain", "missing"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if !strings.Contains(stdout.String(), "Result: missing not found.") {
+			t.Errorf("Expected not found result, got:\n%s", stdout.String())
+		}
+	})
+
+	t.Run("explain alone is a program name", func(t *testing.T) {
+		opts, err := parseArgs([]string{"explain"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.explain || len(opts.names) != 1 || opts.names[0] != "explain" {
+			t.Errorf("Expected a lookup of explain, got explain=%v names=%v", opts.explain, opts.names)
+		}
+	})
+
+	t.Run("after -- explain is a program name", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--", "explain", "prog"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.explain || len(opts.names) != 2 {
+			t.Errorf("Expected two names, got explain=%v names=%v", opts.explain, opts.names)
+		}
+	})
+}
+
+func TestExplainMatchesLookup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("--allow-noexec-ext only applies on Unix")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	script := filepath.Join(tmpDir, "foo.sh")
+	if err := os.WriteFile(script, []byte("echo foo\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	args := []string{"--ext", ".sh", "--allow-noexec-ext", "foo"}
+
+	var stdout, stderr strings.Builder
+	if code := run(args, nil, &stdout, &stderr); code != 0 || stdout.String() != script+"\n" {
+		t.Fatalf("Expected the lookup to find %s, got %q (exit %d)", script, stdout.String(), code)
+	}
+
+	stdout.Reset()
+	if code := run(append([]string{"explain"}, args...), nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (output: %s)", code, stdout.String())
+	}
+	for _, want := range []string{
+		"Trying " + script + "... found, not executable but accepted (--allow-noexec-ext).",
+		"Result: " + script + ".",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	}
+}
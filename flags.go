@@ -0,0 +1,926 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: which [options] <program>...
+       which explain [options] <program>...
+
+Options may appear before, between or after program names. Use -- to treat
+all following arguments as program names, or set WHICH_NO_FLAGS=1 to treat
+every argument, including --, as a program name. An argument @FILE before
+-- stands for the names listed in FILE, one per line.
+
+explain prints a step-by-step account of how each program is looked up.
+
+Options:
+  -a, --all                  print all matches, not just the first
+  --glob                     treat names as glob patterns and print every
+                             matching executable
+  --any-of PATTERNS          print every executable matching any of the
+                             comma-separated glob PATTERNS, sorted by name;
+                             may be repeated
+  --each-dir-once            with --glob, print at most one match per directory
+  --ext-summary              with --glob, print how many matches have each
+                             extension instead of the matches
+  --max-depth N              also search subdirectories of each PATH directory
+                             up to N levels deep (default 0); slow on large
+                             trees
+  -s                         silent: print nothing, only set the exit status
+  --skip-dot                 skip PATH directories that start with a dot
+  --skip-tilde               skip PATH directories that start with a tilde or
+                             lie in the home directory
+  --show-dot                 print ./prog for matches in the current directory
+  --show-tilde               print ~ for the home directory (not for root)
+  --rel-to DIR               print matches relative to DIR, e.g. --rel-to .
+  --relative                 print a relative path argument such as bin/tool
+                             as given instead of making it absolute
+  --no-normalize             print matches as joined from their search
+                             directory, without resolving links or casing
+  --why                      print to stderr how each match was found and what
+                             changed it, e.g. found in PATH[2]; --resolve
+  --follow-lnk               also find NAME.lnk shortcuts and print the
+                             program they point to (Windows)
+  --unc                      print matches on a mapped network drive as UNC
+                             paths of the share (Windows)
+  -i, --read-alias           read shell aliases from stdin and report them
+  --skip-alias               ignore --read-alias
+  --type-a                   read aliases and function names from stdin and
+                             report them with all PATH matches, like type -a
+  --tty-only                 ignore the options that follow when stdout is
+                             not a terminal
+  -V, --version              print the version and exit
+  --only-dir DIR             search only DIR; may be repeated
+  --dir DIR                  search only DIR instead of PATH
+  --any-file                 with --dir or an explicit path, also report files
+                             without execute permission
+  --resolve                  print the target of symlinks instead of the match
+  --applet                   with --resolve, annotate multi-call binary applets
+  --multicall-binaries LIST  comma-separated multi-call binary names
+                             (default: busybox,toybox)
+  --trace-links, --chain     print every hop of a symlink chain and whether it
+                             exists, stopping at the first dangling link
+  --assert PATH              fail unless the program resolves to PATH
+  --require-dir DIR          fail unless the match is in DIR, searching PATH
+                             as usual; may be repeated
+  --realpath-only            fail unless each match is already canonical,
+                             with no symlinks left to resolve
+  --ext-case-sensitive       only match files whose extension has the same case
+                             as in PATHEXT or --ext (Windows)
+  --list-path                print each PATH entry with its status: ok, missing,
+                             not-a-dir or unreadable
+  --show-path                print the directories that would be searched, in
+                             order, one per line
+  --emit-pathext-order       print the extensions tried, in priority order,
+                             with where each comes from
+  --dry-paths, --dump-candidates
+                             print the candidate files that would be checked,
+                             in order, without checking them
+  --whatname FILE            report the command name FILE is invoked as and
+                             whether it is the active match for that name
+  --retry N                  retry a file check up to N times on transient
+                             errors such as EIO (default 0)
+  --format FORMAT            output format: plain (default), json, tsv, path0
+                             (NUL-terminated paths) or long (ls -l style);
+                             WHICH_FORMAT sets the default
+  --no-newline               do not print a newline after the result when
+                             there is only one
+  --shell-quote              quote printed paths for the shell: POSIX single
+                             quotes, or cmd quoting on Windows
+  --ext LIST                 comma-separated extensions to also try after the
+                             bare name, e.g. .sh,.py (added to PATHEXT on
+                             Windows); WHICH_EXT sets the default on Unix
+  --allow-noexec-ext         with --ext on Unix, match extension candidates
+                             without the execute bit
+  --watch                    keep running and print the match again whenever
+                             it changes; stop with Ctrl-C
+  --watch-interval DURATION  how often --watch checks, e.g. 500ms (default 2s)
+  --detect-hardlinks         annotate matches that are hard links to another
+                             match, e.g. with -a or several names
+  --unique-files             print matches that are the same file, through
+                             hard or symbolic links, only once
+  --list                     print the names of all executables in PATH
+  --prefix PREFIX            like --list, but only names starting with PREFIX
+  --summary                  after the results, print to stderr how many
+                             names resolved and which are missing; with
+                             --list, print how many commands each directory
+                             contributes and the total instead
+  --build-completion-cache FILE
+                             write the --list output to FILE and exit
+  --completion-cache FILE    read --list and --prefix names from FILE while
+                             PATH is unchanged, rebuilding it otherwise
+  --warn-case-dupes          with --list, warn about commands whose names
+                             differ only in case, such as foo and FOO
+  --cache FILE               keep an index of the search directories in FILE
+                             across runs, rescanning a directory only when
+                             its modification time changes
+  --arch ARCH                search PATH directories whose path contains ARCH
+                             (e.g. x86_64, arm64) first
+  --reverse                  search the directories in reverse order, so the
+                             last PATH entry wins
+  --prefer-dir DIR           search DIR before PATH, whatever its position in
+                             PATH
+  --resolve-dirs             resolve symlinked PATH directories and search
+                             each real directory once
+  --no-symlink-dirs          skip PATH directories that are symlinks
+  --path PATH                search PATH instead of the PATH environment
+                             variable
+  --pathext PATHEXT          use PATHEXT instead of the PATHEXT environment
+                             variable (Windows)
+  --env-file FILE            take PATH and PATHEXT from a dotenv file, unless
+                             given with --path or --pathext
+  --from-direnv              take PATH and PATHEXT from direnv export json
+                             for the current directory, if direnv is installed
+  --order KEY                sort all printed results, across every name and
+                             -a match, by name, mtime or size (ascending)
+                             instead of argument order then PATH order
+  --min-dirs N               succeed only if each program is found in at least
+                             N PATH directories, and print those directories
+  --pathext-from-registry    when PATHEXT is empty, read it from the registry
+                             before using the defaults (Windows)
+  --unicode-normalize        also try the composed (NFC) and decomposed (NFD)
+                             forms of accented names
+  --inode                    print the device and inode numbers of the file
+                             each match resolves to
+  --print-checksum ALGO      print the sha256, sha1 or md5 digest of each
+                             match
+  --stdin, -                 also read program names from stdin, one per line
+  --no-argfile               look up names starting with @ literally instead
+                             of reading names from the @file
+  -0, --null-input-output    read NUL-separated names from stdin and print
+                             NUL-terminated paths (--stdin --format path0)
+  --audit, --stdin-names-from-path
+                             read program names from stdin, e.g. the commands
+                             a script uses, and print ok, missing or
+                             shadowed:N copies for each
+  --path-set NAME=LIST       search the PATH-like LIST and label its matches
+                             NAME; may be repeated to compare environments
+  --first-dir, --print-first-dir
+                             print only the directory of the first match, e.g.
+                             for PATH="$(which --first-dir node):$PATH"
+  --path-append              print a command that appends the directory of the
+                             first match to PATH, e.g. for eval
+  --shell SHELL              the shell --path-append writes for: sh (default),
+                             bash, zsh, fish, powershell, pwsh or cmd (default
+                             on Windows)
+  -o, --output-file FILE     write results to FILE instead of stdout,
+                             truncating it
+  --append                   with --output-file, append instead of truncating
+  --not-found-exit N         exit with status N instead of 1 when a program is
+                             not found, e.g. 0 to only report it on stderr
+  --first-of                 print only the first program name that is found,
+                             e.g. --first-of rg grep
+  --beside ANCHOR            search only the directory of the program ANCHOR,
+                             found on PATH with symlinks resolved
+  --unshim                   mark matches that are version manager shims
+  --unwrap                   like --unshim, and run the manager's which
+                             command to print the executable a shim runs
+                             (pyenv, rbenv, nodenv, goenv, asdf)
+  --binary-only              skip scripts, files starting with #!, and keep
+                             searching for a compiled program
+  --no-default-path          search nothing when PATH is unset, instead of
+                             /usr/bin:/bin
+  --print-source             annotate each match with where it was found:
+                             PATH[i], CWD (Windows current directory),
+                             EXPLICIT (path argument), DEFAULT (unset PATH)
+                             or DIR (--dir/--only-dir)
+  -v, --verbose              print diagnostics about the environment to stderr
+  --progress                 show how many directories have been scanned on
+                             stderr, when it is a terminal
+  -h, --help                 show this help and exit
+`
+
+type options struct {
+	help                 bool
+	version              bool
+	all                  bool
+	glob                 bool
+	anyOf                []string
+	eachDirOnce          bool
+	maxDepth             int
+	silent               bool
+	skipDot              bool
+	skipTilde            bool
+	showDot              bool
+	showTilde            bool
+	relTo                string
+	readAlias            bool
+	skipAlias            bool
+	onlyDirs             []string
+	dir                  string
+	anyFile              bool
+	resolve              bool
+	applet               bool
+	multicall            []string
+	traceLinks           bool
+	assert               string
+	realpathOnly         bool
+	requireDirs          []string
+	dryPaths             bool
+	whatname             string
+	retry                int
+	verbose              bool
+	showProgress         bool
+	format               string
+	shellQuote           bool
+	binaryOnly           bool
+	noNewline            bool
+	printSource          bool
+	noDefaultPath        bool
+	exts                 []string
+	allowNoexecExt       bool
+	watch                bool
+	watchInterval        time.Duration
+	detectHardlinks      bool
+	uniqueFiles          bool
+	list                 bool
+	prefix               string
+	summary              bool
+	buildCompletionCache string
+	completionCache      string
+	warnCaseDupes        bool
+	cache                string
+	arch                 string
+	preferDir            string
+	reverse              bool
+	resolveDirs          bool
+	noSymlinkDirs        bool
+	path                 *string
+	pathext              *string
+	envFile              string
+	fromDirenv           bool
+	order                string
+	minDirs              int
+	pathextFromRegistry  bool
+	unicodeNormalize     bool
+	inode                bool
+	checksum             string
+	stdinNames           bool
+	noArgfile            bool
+	nullIO               bool
+	audit                bool
+	showPath             bool
+	pathextOrder         bool
+	extCaseSensitive     bool
+	listPath             bool
+	relative             bool
+	noNormalize          bool
+	followLnk            bool
+	unc                  bool
+	typeA                bool
+	pathSets             []pathSet
+	firstDir             bool
+	pathAppend           bool
+	shell                string
+	explain              bool
+	why                  bool
+	unshim               bool
+	unwrap               bool
+	outputFile           string
+	appendOutput         bool
+	beside               string
+	firstOf              bool
+	extSummary           bool
+	notFoundExit         *int
+	names                []string
+
+	// flagNames counts the names given before --; only those can be
+	// @file references.
+	flagNames int
+
+	// setName labels the results of one --path-set search.
+	setName string
+
+	// badFormatEnv is an unknown WHICH_FORMAT value, ignored and
+	// reported under --verbose.
+	badFormatEnv string
+
+	// extFromEnv is set when exts came from WHICH_EXT; badExtEnv holds
+	// its malformed entries, ignored and reported under --verbose.
+	extFromEnv bool
+	badExtEnv  []string
+
+	aliases  map[string]string
+	dirCache *dirCache
+	progress *progress
+	stderr   io.Writer
+}
+
+// pathSet is a named PATH-like list given with --path-set NAME=LIST.
+type pathSet struct {
+	name string
+	path string
+}
+
+// notFoundStatus is the exit status for a program that is not found,
+// exitNotFound unless --not-found-exit says otherwise.
+func (o *options) notFoundStatus() int {
+	if o.notFoundExit != nil {
+		return *o.notFoundExit
+	}
+	return exitNotFound
+}
+
+func (o *options) warnf(format string, args ...any) {
+	if o.stderr == nil || o.silent {
+		return
+	}
+	_, _ = fmt.Fprintf(o.stderr, "warning: "+format+"\n", args...)
+}
+
+// isOnlyExtension reports whether name is nothing but an extension, such as
+// ".exe", which on Windows is a mistake for a program name.
+func isOnlyExtension(name string) bool {
+	return len(name) > 1 && filepath.Ext(name) == name
+}
+
+// reportMode returns the flag of the mode opts selects if it prints a
+// line-based report of its own rather than results, or "". Such a mode has
+// no other output format.
+func reportMode(opts *options) string {
+	switch {
+	case opts.list && opts.prefix != "":
+		return "--prefix"
+	case opts.list:
+		return "--list"
+	case opts.showPath:
+		return "--show-path"
+	case opts.audit:
+		return "--audit"
+	case opts.dryPaths:
+		return "--dry-paths"
+	case opts.explain:
+		return "explain"
+	case opts.minDirs > 0:
+		return "--min-dirs"
+	case opts.typeA:
+		return "--type-a"
+	case opts.extSummary:
+		return "--ext-summary"
+	}
+	return ""
+}
+
+// extEnv splits a WHICH_EXT value, separated by colons or commas, into
+// valid extensions and malformed entries.
+func extEnv(value string) (exts, bad []string) {
+	for _, ext := range strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ',' }) {
+		ext = strings.TrimSpace(ext)
+		switch {
+		case ext == "":
+		case !strings.HasPrefix(ext, ".") || len(ext) == 1 || strings.ContainsAny(ext, `/\`):
+			bad = append(bad, ext)
+		default:
+			exts = append(exts, ext)
+		}
+	}
+	return exts, bad
+}
+
+// parser walks the command line one flag at a time. Flags taking a value
+// accept it either inline (--flag=value) or as the following argument.
+type parser struct {
+	args   []string
+	pos    int
+	flag   string
+	value  string
+	inline bool
+}
+
+func parseArgs(args []string) (*options, error) {
+	// WHICH_NO_FLAGS=1 makes every argument a program name, as if the
+	// command line started with --; a -- of its own is then a name too.
+	if os.Getenv("WHICH_NO_FLAGS") == "1" {
+		args = append([]string{"--"}, args...)
+	}
+
+	opts := &options{}
+	p := &parser{args: args}
+
+	// After --tty-only on a non-terminal, flags are still parsed so their
+	// values are consumed, but they are applied to a discarded copy.
+	target := opts
+	ttyOnly := false
+	dashDash := false
+
+	for ; p.pos < len(args); p.pos++ {
+		arg := args[p.pos]
+
+		if arg == "--" {
+			opts.flagNames = len(opts.names)
+			dashDash = true
+			opts.names = append(opts.names, args[p.pos+1:]...)
+			break
+		}
+		// A bare - reads names from stdin, as --stdin does. After -- it
+		// is a name like any other.
+		if arg == "-" {
+			opts.stdinNames = true
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if arg == "explain" && len(opts.names) == 0 && !opts.explain {
+				opts.explain = true
+				continue
+			}
+			opts.names = append(opts.names, arg)
+			continue
+		}
+
+		p.flag, p.value, p.inline = strings.Cut(arg, "=")
+
+		var err error
+		switch opts := target; p.flag {
+		case "-h", "--help":
+			err = p.bool(&opts.help)
+		case "-V", "--version":
+			err = p.bool(&opts.version)
+		case "-a", "--all":
+			err = p.bool(&opts.all)
+		case "--glob":
+			err = p.bool(&opts.glob)
+		case "--any-of":
+			err = p.list(&opts.anyOf)
+		case "--each-dir-once":
+			err = p.bool(&opts.eachDirOnce)
+		case "--max-depth":
+			err = p.int(&opts.maxDepth)
+		case "-s":
+			err = p.bool(&opts.silent)
+		case "--skip-dot":
+			err = p.bool(&opts.skipDot)
+		case "--skip-tilde":
+			err = p.bool(&opts.skipTilde)
+		case "--show-dot":
+			err = p.bool(&opts.showDot)
+		case "--show-tilde":
+			err = p.bool(&opts.showTilde)
+		case "--rel-to":
+			err = p.string(&opts.relTo)
+		case "-i", "--read-alias":
+			err = p.bool(&opts.readAlias)
+		case "--skip-alias":
+			err = p.bool(&opts.skipAlias)
+		case "--tty-only":
+			err = p.bool(&ttyOnly)
+			if ttyOnly && !isTerminal(os.Stdout) {
+				target = &options{}
+			}
+		case "--only-dir":
+			err = p.strings(&opts.onlyDirs)
+		case "--dir":
+			err = p.string(&opts.dir)
+		case "--any-file":
+			err = p.bool(&opts.anyFile)
+		case "--resolve":
+			err = p.bool(&opts.resolve)
+		case "--applet":
+			err = p.bool(&opts.applet)
+		case "--multicall-binaries":
+			err = p.list(&opts.multicall)
+		case "--trace-links", "--chain":
+			err = p.bool(&opts.traceLinks)
+		case "--require-dir":
+			err = p.strings(&opts.requireDirs)
+		case "--print-checksum":
+			err = p.string(&opts.checksum)
+		case "--realpath-only":
+			err = p.bool(&opts.realpathOnly)
+		case "--assert":
+			err = p.string(&opts.assert)
+		case "--dry-paths", "--dump-candidates":
+			err = p.bool(&opts.dryPaths)
+		case "--whatname":
+			err = p.string(&opts.whatname)
+		case "--retry":
+			err = p.int(&opts.retry)
+		case "--format":
+			err = p.string(&opts.format)
+		case "--binary-only":
+			err = p.bool(&opts.binaryOnly)
+		case "--no-newline":
+			err = p.bool(&opts.noNewline)
+		case "--shell-quote":
+			err = p.bool(&opts.shellQuote)
+		case "--ext":
+			// Even an empty --ext overrides WHICH_EXT.
+			err = p.list(&opts.exts)
+			if opts.exts == nil {
+				opts.exts = []string{}
+			}
+		case "--allow-noexec-ext":
+			err = p.bool(&opts.allowNoexecExt)
+		case "--watch":
+			err = p.bool(&opts.watch)
+		case "--watch-interval":
+			err = p.duration(&opts.watchInterval)
+		case "--unique-files":
+			err = p.bool(&opts.uniqueFiles)
+		case "--detect-hardlinks":
+			err = p.bool(&opts.detectHardlinks)
+		case "--list":
+			err = p.bool(&opts.list)
+		case "--summary":
+			err = p.bool(&opts.summary)
+		case "--prefix":
+			err = p.string(&opts.prefix)
+			opts.list = true
+		case "--build-completion-cache":
+			err = p.string(&opts.buildCompletionCache)
+		case "--completion-cache":
+			err = p.string(&opts.completionCache)
+		case "--warn-case-dupes":
+			err = p.bool(&opts.warnCaseDupes)
+		case "--cache":
+			err = p.string(&opts.cache)
+		case "--arch":
+			err = p.string(&opts.arch)
+		case "--reverse":
+			err = p.bool(&opts.reverse)
+		case "--prefer-dir":
+			err = p.string(&opts.preferDir)
+		case "--resolve-dirs":
+			err = p.bool(&opts.resolveDirs)
+		case "--no-symlink-dirs":
+			err = p.bool(&opts.noSymlinkDirs)
+		case "--path":
+			err = p.set(&opts.path)
+		case "--pathext":
+			err = p.set(&opts.pathext)
+		case "--from-direnv":
+			err = p.bool(&opts.fromDirenv)
+		case "--env-file":
+			err = p.string(&opts.envFile)
+		case "--order":
+			err = p.string(&opts.order)
+		case "--min-dirs":
+			err = p.int(&opts.minDirs)
+		case "--pathext-from-registry":
+			err = p.bool(&opts.pathextFromRegistry)
+		case "--unicode-normalize":
+			err = p.bool(&opts.unicodeNormalize)
+		case "--inode":
+			err = p.bool(&opts.inode)
+		case "--no-argfile":
+			err = p.bool(&opts.noArgfile)
+		case "--stdin":
+			err = p.bool(&opts.stdinNames)
+		case "-0", "--null-input-output":
+			err = p.bool(&opts.nullIO)
+		case "--ext-case-sensitive":
+			err = p.bool(&opts.extCaseSensitive)
+		case "--relative":
+			err = p.bool(&opts.relative)
+		case "--type-a":
+			err = p.bool(&opts.typeA)
+		case "--unc":
+			err = p.bool(&opts.unc)
+		case "--why":
+			err = p.bool(&opts.why)
+		case "--follow-lnk":
+			err = p.bool(&opts.followLnk)
+		case "--no-normalize":
+			err = p.bool(&opts.noNormalize)
+		case "--list-path":
+			err = p.bool(&opts.listPath)
+		case "--emit-pathext-order":
+			err = p.bool(&opts.pathextOrder)
+		case "--show-path":
+			err = p.bool(&opts.showPath)
+		case "--audit", "--stdin-names-from-path":
+			err = p.bool(&opts.audit)
+		case "--path-set":
+			err = p.pathSet(&opts.pathSets)
+		case "--first-dir", "--print-first-dir":
+			err = p.bool(&opts.firstDir)
+		case "--path-append":
+			err = p.bool(&opts.pathAppend)
+		case "--shell":
+			err = p.string(&opts.shell)
+		case "-o", "--output-file":
+			err = p.string(&opts.outputFile)
+		case "--append":
+			err = p.bool(&opts.appendOutput)
+		case "--not-found-exit":
+			var status int
+			if err = p.int(&status); err == nil && status > 255 {
+				err = fmt.Errorf("flag %s requires an exit status from 0 to 255, got %d", p.flag, status)
+			}
+			opts.notFoundExit = &status
+		case "--ext-summary":
+			err = p.bool(&opts.extSummary)
+		case "--first-of":
+			err = p.bool(&opts.firstOf)
+		case "--beside":
+			err = p.string(&opts.beside)
+		case "--unshim":
+			err = p.bool(&opts.unshim)
+		case "--unwrap":
+			err = p.bool(&opts.unwrap)
+		case "--no-default-path":
+			err = p.bool(&opts.noDefaultPath)
+		case "--print-source":
+			err = p.bool(&opts.printSource)
+		case "-v", "--verbose":
+			err = p.bool(&opts.verbose)
+		case "--progress":
+			err = p.bool(&opts.showProgress)
+		default:
+			err = fmt.Errorf("unknown flag: %s", p.flag)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !dashDash {
+		opts.flagNames = len(opts.names)
+	}
+
+	// "which explain" without further names looks up a program called
+	// explain.
+	if opts.explain && len(opts.names) == 0 && !opts.stdinNames && !opts.nullIO {
+		opts.explain = false
+		opts.names = []string{"explain"}
+	}
+
+	if len(opts.anyOf) > 0 {
+		if len(opts.names) > 0 || opts.firstOf {
+			return nil, fmt.Errorf("--any-of cannot be combined with program names or --first-of")
+		}
+		opts.glob = true
+		opts.names = opts.anyOf
+	}
+
+	if runtime.GOOS == "windows" && !opts.glob {
+		for _, name := range opts.names {
+			if isOnlyExtension(name) {
+				return nil, fmt.Errorf("%s is only an extension; give the program name, e.g. go%s", name, name)
+			}
+		}
+	}
+
+	if opts.glob {
+		for _, pattern := range opts.names {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob pattern %q: %v", pattern, err)
+			}
+		}
+	}
+	if opts.relTo != "" && (opts.showDot || opts.showTilde) {
+		return nil, fmt.Errorf("--rel-to cannot be combined with --show-dot or --show-tilde")
+	}
+
+	if opts.uniqueFiles && opts.detectHardlinks {
+		return nil, fmt.Errorf("--unique-files cannot be combined with --detect-hardlinks")
+	}
+
+	if opts.extSummary && !opts.glob {
+		return nil, fmt.Errorf("--ext-summary requires --glob")
+	}
+	if opts.eachDirOnce && !opts.glob {
+		return nil, fmt.Errorf("--each-dir-once requires --glob")
+	}
+
+	if opts.exts == nil && runtime.GOOS != "windows" {
+		opts.exts, opts.badExtEnv = extEnv(os.Getenv("WHICH_EXT"))
+		opts.extFromEnv = len(opts.exts) > 0
+	}
+	for _, ext := range opts.exts {
+		if !strings.HasPrefix(ext, ".") || len(ext) == 1 || strings.ContainsAny(ext, `/\`) {
+			return nil, fmt.Errorf("invalid extension %q, expected a dot followed by a name such as .sh", ext)
+		}
+	}
+	if opts.allowNoexecExt && len(opts.exts) == 0 {
+		return nil, fmt.Errorf("--allow-noexec-ext requires --ext")
+	}
+
+	if opts.beside != "" && (opts.dir != "" || len(opts.onlyDirs) > 0) {
+		return nil, fmt.Errorf("--beside cannot be combined with --dir or --only-dir")
+	}
+
+	if opts.appendOutput && opts.outputFile == "" {
+		return nil, fmt.Errorf("--append requires --output-file")
+	}
+
+	if opts.watchInterval != 0 && !opts.watch {
+		return nil, fmt.Errorf("--watch-interval requires --watch")
+	}
+
+	if (opts.list || opts.buildCompletionCache != "") && len(opts.names) > 0 {
+		return nil, fmt.Errorf("--list, --prefix and --build-completion-cache do not take program names")
+	}
+	if (opts.showPath || opts.listPath || opts.pathextOrder) && len(opts.names) > 0 {
+		return nil, fmt.Errorf("--show-path, --list-path and --emit-pathext-order do not take program names")
+	}
+	if opts.completionCache != "" && !opts.list {
+		return nil, fmt.Errorf("--completion-cache requires --list or --prefix")
+	}
+	if opts.warnCaseDupes && !opts.list {
+		return nil, fmt.Errorf("--warn-case-dupes requires --list or --prefix")
+	}
+
+	if opts.skipAlias {
+		opts.readAlias = false
+	}
+
+	if opts.audit {
+		opts.stdinNames = true
+	}
+	if opts.unwrap {
+		opts.unshim = true
+	}
+	if opts.nullIO {
+		if opts.format != "" && opts.format != "path0" {
+			return nil, fmt.Errorf("-0 cannot be combined with --format %s", opts.format)
+		}
+		opts.stdinNames = true
+		opts.format = "path0"
+	}
+	if mode := reportMode(opts); mode != "" && opts.format != "" {
+		if opts.nullIO {
+			return nil, fmt.Errorf("%s cannot be combined with -0", mode)
+		}
+		return nil, fmt.Errorf("%s cannot be combined with --format", mode)
+	}
+	if len(opts.pathSets) > 0 && opts.path != nil {
+		return nil, fmt.Errorf("--path-set cannot be combined with --path")
+	}
+	if opts.stdinNames && opts.readAlias {
+		return nil, fmt.Errorf("--stdin and --read-alias both read stdin")
+	}
+	if opts.typeA && (opts.stdinNames || opts.readAlias) {
+		return nil, fmt.Errorf("--type-a reads definitions from stdin and cannot be combined with --stdin or --read-alias")
+	}
+
+	// WHICH_FORMAT sets the default format. An unknown value is ignored
+	// rather than rejected, so a stale variable cannot break every call,
+	// and so is a format that flags on the command line cannot use.
+	if opts.format == "" {
+		env := os.Getenv("WHICH_FORMAT")
+		switch {
+		case !slices.Contains(outputFormats, env):
+			opts.badFormatEnv = env
+		case opts.noNewline && (env == "json" || env == "path0"):
+		case opts.pathAppend && env != "plain":
+		case opts.listPath && env != "plain" && env != "json":
+		default:
+			opts.format = env
+		}
+	}
+	if opts.format == "" {
+		opts.format = "plain"
+	}
+	if !slices.Contains(outputFormats, opts.format) {
+		return nil, fmt.Errorf("unknown format %q, expected one of: %s", opts.format, strings.Join(outputFormats, ", "))
+	}
+
+	if opts.noNewline && (opts.format == "json" || opts.format == "path0") {
+		return nil, fmt.Errorf("--no-newline cannot be combined with --format %s", opts.format)
+	}
+
+	// --list-path prints its own report, as plain lines or as JSON.
+	if opts.listPath && opts.format != "plain" && opts.format != "json" {
+		if opts.nullIO {
+			return nil, fmt.Errorf("--list-path cannot be combined with -0")
+		}
+		return nil, fmt.Errorf("--list-path cannot be combined with --format %s", opts.format)
+	}
+
+	if opts.pathAppend {
+		opts.firstDir = true
+		if opts.format != "plain" {
+			return nil, fmt.Errorf("--path-append cannot be combined with --format %s", opts.format)
+		}
+	}
+	if opts.shell != "" && !opts.pathAppend {
+		return nil, fmt.Errorf("--shell requires --path-append")
+	}
+	if opts.shell == "" {
+		opts.shell = defaultShell()
+	}
+	if !slices.Contains(pathAppendShells, opts.shell) {
+		return nil, fmt.Errorf("unknown shell %q, expected one of: %s", opts.shell, strings.Join(pathAppendShells, ", "))
+	}
+
+	if opts.checksum != "" && !slices.Contains(checksumAlgorithms, opts.checksum) {
+		return nil, fmt.Errorf("unknown checksum %q, expected one of: %s", opts.checksum, strings.Join(checksumAlgorithms, ", "))
+	}
+
+	if opts.order != "" && !slices.Contains(orderKeys, opts.order) {
+		return nil, fmt.Errorf("unknown order %q, expected one of: %s", opts.order, strings.Join(orderKeys, ", "))
+	}
+
+	if opts.applet && !opts.resolve {
+		return nil, fmt.Errorf("--applet requires --resolve")
+	}
+
+	return opts, nil
+}
+
+func (p *parser) bool(dst *bool) error {
+	if p.inline {
+		return fmt.Errorf("flag %s does not take a value", p.flag)
+	}
+	*dst = true
+	return nil
+}
+
+func (p *parser) string(dst *string) error {
+	if p.inline {
+		*dst = p.value
+		return nil
+	}
+	if p.pos+1 >= len(p.args) {
+		return fmt.Errorf("flag %s requires a value", p.flag)
+	}
+	p.pos++
+	*dst = p.args[p.pos]
+	return nil
+}
+
+// set stores the value in a new string, so that an explicitly empty value
+// can be told apart from a missing flag.
+func (p *parser) set(dst **string) error {
+	var value string
+	if err := p.string(&value); err != nil {
+		return err
+	}
+	*dst = &value
+	return nil
+}
+
+func (p *parser) strings(dst *[]string) error {
+	var value string
+	if err := p.string(&value); err != nil {
+		return err
+	}
+	*dst = append(*dst, value)
+	return nil
+}
+
+func (p *parser) int(dst *int) error {
+	var value string
+	if err := p.string(&value); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("flag %s requires a non-negative integer, got %q", p.flag, value)
+	}
+	*dst = n
+	return nil
+}
+
+func (p *parser) duration(dst *time.Duration) error {
+	var value string
+	if err := p.string(&value); err != nil {
+		return err
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("flag %s requires a positive duration such as 500ms, got %q", p.flag, value)
+	}
+	*dst = d
+	return nil
+}
+
+func (p *parser) pathSet(dst *[]pathSet) error {
+	var value string
+	if err := p.string(&value); err != nil {
+		return err
+	}
+	name, path, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("flag %s requires NAME=LIST, got %q", p.flag, value)
+	}
+	*dst = append(*dst, pathSet{name, path})
+	return nil
+}
+
+// list appends the comma-separated items of the flag value to dst.
+func (p *parser) list(dst *[]string) error {
+	var value string
+	if err := p.string(&value); err != nil {
+		return err
+	}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*dst = append(*dst, item)
+		}
+	}
+	return nil
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
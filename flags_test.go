@@ -0,0 +1,318 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Run("collects names", func(t *testing.T) {
+		opts, err := parseArgs([]string{"go", "gofmt"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(opts.names, []string{"go", "gofmt"}) {
+			t.Errorf("Unexpected names: %v", opts.names)
+		}
+	})
+
+	t.Run("accepts separate and inline values", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--only-dir", "/a", "--only-dir=/b", "go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(opts.onlyDirs, []string{"/a", "/b"}) {
+			t.Errorf("Unexpected only dirs: %v", opts.onlyDirs)
+		}
+		if !reflect.DeepEqual(opts.names, []string{"go"}) {
+			t.Errorf("Unexpected names: %v", opts.names)
+		}
+	})
+
+	t.Run("accepts flags between and after names", func(t *testing.T) {
+		opts, err := parseArgs([]string{"go", "--all", "gofmt", "--only-dir", "/a"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !opts.all {
+			t.Error("Expected --all between names to apply")
+		}
+		if !reflect.DeepEqual(opts.onlyDirs, []string{"/a"}) {
+			t.Errorf("Expected --only-dir after names to apply, got %v", opts.onlyDirs)
+		}
+		if !reflect.DeepEqual(opts.names, []string{"go", "gofmt"}) {
+			t.Errorf("Unexpected names: %v", opts.names)
+		}
+	})
+
+	t.Run("double dash keeps dash-leading names literal", func(t *testing.T) {
+		opts, err := parseArgs([]string{"go", "--", "-weird", "--all"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.all {
+			t.Error("Expected --all after -- to be a name")
+		}
+		if !reflect.DeepEqual(opts.names, []string{"go", "-weird", "--all"}) {
+			t.Errorf("Unexpected names: %v", opts.names)
+		}
+	})
+
+	t.Run("double dash ends flags", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--", "--help"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.help {
+			t.Error("Expected --help after -- to be a name")
+		}
+		if !reflect.DeepEqual(opts.names, []string{"--help"}) {
+			t.Errorf("Unexpected names: %v", opts.names)
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown flag", []string{"--bogus", "go"}},
+		{"missing value", []string{"--only-dir"}},
+		{"value for boolean flag", []string{"--help=yes"}},
+		{"non-numeric integer", []string{"--retry", "many", "go"}},
+		{"negative integer", []string{"--retry=-1", "go"}},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseArgs(tt.args); err == nil {
+				t.Errorf("Expected error for %v", tt.args)
+			}
+		})
+	}
+}
+
+func TestParseArgsApplet(t *testing.T) {
+	t.Run("splits the multi-call list", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--resolve", "--applet", "--multicall-binaries", "busybox, toybox,", "ls"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(opts.multicall, []string{"busybox", "toybox"}) {
+			t.Errorf("Unexpected multi-call list: %v", opts.multicall)
+		}
+	})
+
+	t.Run("applet requires resolve", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--applet", "ls"}); err == nil {
+			t.Error("Expected error for --applet without --resolve")
+		}
+	})
+}
+
+func TestParseArgsTTYOnly(t *testing.T) {
+	if isTerminal(os.Stdout) {
+		t.Skip("stdout is a terminal")
+	}
+
+	opts, err := parseArgs([]string{"-a", "--tty-only", "--format", "json", "-s", "go"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !opts.all {
+		t.Error("Expected -a before --tty-only to apply")
+	}
+	if opts.silent || opts.format != "plain" {
+		t.Error("Expected options after --tty-only to be ignored")
+	}
+	if !reflect.DeepEqual(opts.names, []string{"go"}) {
+		t.Errorf("Unexpected names: %v", opts.names)
+	}
+}
+
+func TestParseArgsNoFlags(t *testing.T) {
+	t.Cleanup(func() { _ = os.Unsetenv("WHICH_NO_FLAGS") })
+	if err := os.Setenv("WHICH_NO_FLAGS", "1"); err != nil {
+		t.Fatalf("Failed to set WHICH_NO_FLAGS: %v", err)
+	}
+
+	opts, err := parseArgs([]string{"--help", "-a", "--", "go"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if opts.help || opts.all {
+		t.Error("Expected flags to be treated as names")
+	}
+	if !reflect.DeepEqual(opts.names, []string{"--help", "-a", "--", "go"}) {
+		t.Errorf("Unexpected names: %v", opts.names)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"--help"}, nil, &stdout, &stderr); code != exitNotFound {
+		t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected no usage output, got %q", stdout.String())
+	}
+	if stderr.String() != "--help not found in PATH\n" {
+		t.Errorf("Expected --help to be looked up, got %q", stderr.String())
+	}
+}
+
+func TestOnlyExtension(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{".exe", true},
+		{".EXE", true},
+		{"go.exe", false},
+		{"go", false},
+		{".", false},
+		{"..", false},
+		{".config.exe", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if result := isOnlyExtension(tt.input); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("usage error on Windows", func(t *testing.T) {
+		if runtime.GOOS != "windows" {
+			t.Skip("Names like .exe are valid hidden files on Unix")
+		}
+		var stdout, stderr strings.Builder
+		if code := run([]string{".exe"}, nil, &stdout, &stderr); code != exitUsage {
+			t.Errorf("Expected exit code %d, got %d", exitUsage, code)
+		}
+		if !strings.HasPrefix(stderr.String(), ".exe is only an extension") {
+			t.Errorf("Expected a usage error, got %q", stderr.String())
+		}
+	})
+}
+
+func TestFormatEnv(t *testing.T) {
+	t.Cleanup(func() { _ = os.Unsetenv("WHICH_FORMAT") })
+	if err := os.Setenv("WHICH_FORMAT", "json"); err != nil {
+		t.Fatalf("Failed to set WHICH_FORMAT: %v", err)
+	}
+
+	t.Run("default", func(t *testing.T) {
+		opts, err := parseArgs([]string{"go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.format != "json" {
+			t.Errorf("Expected json, got %s", opts.format)
+		}
+	})
+
+	t.Run("flag overrides", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--format", "tsv", "go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.format != "tsv" {
+			t.Errorf("Expected tsv, got %s", opts.format)
+		}
+	})
+
+	t.Run("gives way to --no-newline", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--no-newline", "go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.format != "plain" {
+			t.Errorf("Expected plain, got %s", opts.format)
+		}
+		if _, err := parseArgs([]string{"--no-newline", "--format", "json", "go"}); err == nil {
+			t.Error("Expected an error for --no-newline with an explicit --format json")
+		}
+	})
+
+	t.Run("gives way to --path-append", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--path-append", "go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.format != "plain" {
+			t.Errorf("Expected plain, got %s", opts.format)
+		}
+		if _, err := parseArgs([]string{"--path-append", "--format", "json", "go"}); err == nil {
+			t.Error("Expected an error for --path-append with an explicit --format json")
+		}
+	})
+
+	t.Run("gives way to --list-path", func(t *testing.T) {
+		if err := os.Setenv("WHICH_FORMAT", "tsv"); err != nil {
+			t.Fatalf("Failed to set WHICH_FORMAT: %v", err)
+		}
+		opts, err := parseArgs([]string{"--list-path"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.format != "plain" {
+			t.Errorf("Expected plain, got %s", opts.format)
+		}
+	})
+
+	t.Run("unknown value is ignored", func(t *testing.T) {
+		if err := os.Setenv("WHICH_FORMAT", "yaml"); err != nil {
+			t.Fatalf("Failed to set WHICH_FORMAT: %v", err)
+		}
+		opts, err := parseArgs([]string{"go"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.format != "plain" {
+			t.Errorf("Expected plain, got %s", opts.format)
+		}
+
+		var stdout, stderr strings.Builder
+		run([]string{"-v", "which-test-missing"}, nil, &stdout, &stderr)
+		if !strings.Contains(stderr.String(), `warning: unknown WHICH_FORMAT "yaml"`) {
+			t.Errorf("Expected a warning about WHICH_FORMAT, got %q", stderr.String())
+		}
+	})
+}
+
+func TestReportModeFormat(t *testing.T) {
+	tests := [][]string{
+		{"--list", "--format", "json"},
+		{"--prefix", "go", "--format", "tsv"},
+		{"--show-path", "--format", "json"},
+		{"--audit", "--format", "json"},
+		{"--dry-paths", "-0"},
+		{"explain", "go", "--format", "json"},
+		{"--min-dirs", "2", "go", "--format", "json"},
+		{"--type-a", "--format", "json"},
+		{"--glob", "--ext-summary", "*", "--format", "json"},
+		{"--list-path", "--format", "tsv"},
+		{"--list-path", "-0"},
+	}
+	for _, args := range tests {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			if _, err := parseArgs(args); err == nil {
+				t.Errorf("Expected an error for %v", args)
+			}
+		})
+	}
+
+	t.Run("default format", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--dry-paths", "go"}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+
+	t.Run("--list-path allows json", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--list-path", "--format", "json"}); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
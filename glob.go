@@ -0,0 +1,131 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// globExecutables returns the executables in the search directories whose
+// name matches pattern. On Windows the pattern may match the name with or
+// without its PATHEXT extension, and only files with such an extension are
+// considered.
+func globExecutables(pattern string, opts *options) []match {
+	extensions := getExtensions(opts)
+
+	var matches []match
+	walkSearchDirs(opts, func(root, dir string) bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+
+		for _, entry := range entries {
+			if !matchesGlob(pattern, entry.Name(), extensions) {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path, opts) || opts.binaryOnly && isScript(path) {
+				continue
+			}
+			matches = append(matches, match{resultPath(path, opts), dirSource(root, opts)})
+			if opts.eachDirOnce {
+				break
+			}
+		}
+		return false
+	})
+	return matches
+}
+
+func matchesGlob(pattern, name string, extensions []string) bool {
+	if len(extensions) == 0 {
+		ok, _ := filepath.Match(pattern, name)
+		return ok
+	}
+
+	ext := filepath.Ext(name)
+	for _, e := range extensions {
+		if !strings.EqualFold(ext, e) {
+			continue
+		}
+		if ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(name)); ok {
+			return true
+		}
+		ok, _ := filepath.Match(strings.ToLower(pattern), strings.ToLower(strings.TrimSuffix(name, ext)))
+		return ok
+	}
+	return false
+}
+
+// extCount is the number of --ext-summary matches with one extension.
+type extCount struct {
+	ext   string
+	count int
+}
+
+// runExtSummary prints, for the executables matching any of the glob
+// patterns, how many have each extension, most common first.
+func runExtSummary(w io.Writer, opts *options) int {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, pattern := range opts.names {
+		for _, m := range globExecutables(pattern, opts) {
+			if !seen[m.path] {
+				seen[m.path] = true
+				paths = append(paths, m.path)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		if !opts.silent {
+			where := "PATH"
+			if opts.setName != "" {
+				where = opts.setName
+			}
+			for _, pattern := range opts.names {
+				_, _ = fmt.Fprintf(opts.stderr, "%s not found in %s\n", pattern, where)
+			}
+		}
+		return opts.notFoundStatus()
+	}
+
+	for _, c := range countExtensions(paths) {
+		if _, err := fmt.Fprintf(w, "%s: %d\n", c.ext, c.count); err != nil {
+			_, _ = fmt.Fprintln(opts.stderr, err)
+			return exitFailure
+		}
+	}
+	return 0
+}
+
+// countExtensions groups paths by extension, ignoring case on Windows, and
+// sorts the groups by count, then extension. Paths without an extension are
+// counted as "(none)".
+func countExtensions(paths []string) []extCount {
+	counts := make(map[string]int)
+	for _, path := range paths {
+		ext := filepath.Ext(path)
+		if runtime.GOOS == "windows" {
+			ext = strings.ToUpper(ext)
+		}
+		if ext == "" {
+			ext = "(none)"
+		}
+		counts[ext]++
+	}
+
+	var summary []extCount
+	for ext, count := range counts {
+		summary = append(summary, extCount{ext, count})
+	}
+	slices.SortFunc(summary, func(a, b extCount) int {
+		return cmp.Or(cmp.Compare(b.count, a.count), cmp.Compare(a.ext, b.ext))
+	})
+	return summary
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMatchesGlob(t *testing.T) {
+	windowsExts := []string{".COM", ".EXE", ".BAT", ".CMD"}
+
+	tests := []struct {
+		name       string
+		pattern    string
+		file       string
+		extensions []string
+		expected   bool
+	}{
+		{"unix match", "py*", "python3", nil, true},
+		{"unix no match", "py*", "ruby", nil, false},
+		{"unix is case-sensitive", "PY*", "python3", nil, false},
+		{"windows without extension", "py*", "python.exe", windowsExts, true},
+		{"windows with extension", "*.cmd", "tool.CMD", windowsExts, true},
+		{"windows anchored without extension", "python", "python.exe", windowsExts, true},
+		{"windows non-executable extension", "py*", "python.txt", windowsExts, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := matchesGlob(tt.pattern, tt.file, tt.extensions)
+			if result != tt.expected {
+				t.Errorf("matchesGlob(%q, %q) = %v, expected %v", tt.pattern, tt.file, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGlob(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir1, err := os.MkdirTemp("", "which-test1")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir1) })
+
+	tmpDir2, err := os.MkdirTemp("", "which-test2")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir2) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir1); err == nil {
+			tmpDir1 = resolved
+		}
+		if resolved, err := filepath.EvalSymlinks(tmpDir2); err == nil {
+			tmpDir2 = resolved
+		}
+	}
+
+	ext := ""
+	if runtime.GOOS == "windows" {
+		ext = ".exe"
+	}
+	for _, exe := range []string{
+		filepath.Join(tmpDir1, "gofmt"+ext),
+		filepath.Join(tmpDir1, "golint"+ext),
+		filepath.Join(tmpDir1, "gopls"+ext),
+		filepath.Join(tmpDir2, "go"+ext),
+		filepath.Join(tmpDir2, "python"+ext),
+	} {
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir1+string(os.PathListSeparator)+tmpDir2); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("prints every match", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--glob", "go*"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if lines := strings.Fields(stdout.String()); len(lines) != 4 {
+			t.Errorf("Expected 4 matches, got %q", stdout.String())
+		}
+	})
+
+	t.Run("each dir once emits one match per directory", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--glob", "--each-dir-once", "go*"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		lines := strings.Fields(stdout.String())
+		if len(lines) != 2 {
+			t.Fatalf("Expected 2 matches, got %q", stdout.String())
+		}
+		if !strings.EqualFold(filepath.Dir(lines[0]), tmpDir1) || !strings.EqualFold(filepath.Dir(lines[1]), tmpDir2) {
+			t.Errorf("Expected one match from each directory, got %q", stdout.String())
+		}
+	})
+
+	t.Run("no match exits 1", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--glob", "zz*"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+	})
+
+	t.Run("invalid pattern is a usage error", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--glob", "go["}, nil, &stdout, &stderr)
+		if code != exitUsage {
+			t.Errorf("Expected exit code %d, got %d", exitUsage, code)
+		}
+	})
+}
+
+func TestCountExtensions(t *testing.T) {
+	paths := []string{"go", "gofmt", "build.sh", "deploy.sh", "tool.py"}
+	expected := "(none): 2, .sh: 2, .py: 1"
+	if runtime.GOOS == "windows" {
+		paths = []string{"go.exe", "gofmt.EXE", "build.cmd", "deploy.CMD", "tool.bat"}
+		expected = ".CMD: 2, .EXE: 2, .BAT: 1"
+	}
+
+	var parts []string
+	for _, c := range countExtensions(paths) {
+		parts = append(parts, c.ext+": "+strconv.Itoa(c.count))
+	}
+	if result := strings.Join(parts, ", "); result != expected {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestExtSummary(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("PATHEXT extensions are Windows-specific")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	for _, name := range []string{"a.exe", "b.exe", "c.EXE", "d.cmd", "e.bat", "f.bat", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"--glob", "--ext-summary", "*"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	expected := ".EXE: 3\n.BAT: 2\n.CMD: 1\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestExtSummaryNotFound(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	for _, tt := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{[]string{"--glob", "--ext-summary", "--skip-dot", "zzz*"}, exitNotFound, "zzz* not found in PATH\n"},
+		{[]string{"--glob", "--ext-summary", "--skip-dot", "--not-found-exit", "0", "zzz*"}, 0, "zzz* not found in PATH\n"},
+		{[]string{"--glob", "--ext-summary", "--skip-dot", "--not-found-exit", "4", "zzz*"}, 4, "zzz* not found in PATH\n"},
+		{[]string{"--glob", "--ext-summary", "--skip-dot", "-s", "zzz*"}, exitNotFound, ""},
+	} {
+		var stdout, stderr strings.Builder
+		if code := run(tt.args, nil, &stdout, &stderr); code != tt.code {
+			t.Errorf("Expected exit code %d for %v, got %d", tt.code, tt.args, code)
+		}
+		if stderr.String() != tt.stderr {
+			t.Errorf("Expected %q for %v, got %q", tt.stderr, tt.args, stderr.String())
+		}
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	for _, name := range []string{"ruby", "python3", "pydoc", "perl"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name+exe), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("union sorted by name", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--any-of", "ruby*,py*", "--any-of", "python*"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		var expected string
+		for _, name := range []string{"pydoc", "python3", "ruby"} {
+			expected += filepath.Join(tmpDir, name+exe) + "\n"
+		}
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("a pattern without matches", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--any-of", "ruby*,node*"}, nil, &stdout, &stderr); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no errors, got %q", stderr.String())
+		}
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--any-of", "node*,go*"}, nil, &stdout, &stderr); code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stderr.String() != "none of node*, go* found in PATH\n" {
+			t.Errorf("Expected a single error, got %q", stderr.String())
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := parseArgs([]string{"--any-of", "py*,[", "--any-of", "ruby*"})
+		if err == nil || !strings.Contains(err.Error(), `"["`) {
+			t.Errorf("Expected an error naming the bad pattern, got %v", err)
+		}
+	})
+}
+
+func TestWildcardHint(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	hint := "foo* contains wildcard characters; did you mean --glob?"
+
+	t.Run("literal lookup", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"foo*"}, nil, &stdout, &stderr); code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		expected := "foo* not found in PATH\n" + hint + "\n"
+		if stderr.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+
+	t.Run("no hint with --glob", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		run([]string{"--glob", "foo*"}, nil, &stdout, &stderr)
+		if strings.Contains(stderr.String(), "did you mean") {
+			t.Errorf("Expected no hint, got %q", stderr.String())
+		}
+	})
+
+	t.Run("no hint when silent", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		run([]string{"-s", "foo*"}, nil, &stdout, &stderr)
+		if stderr.String() != "" {
+			t.Errorf("Expected no output, got %q", stderr.String())
+		}
+	})
+}
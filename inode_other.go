@@ -0,0 +1,23 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode numbers of the file path refers to,
+// following symlinks.
+func fileID(path string) (device, inode uint64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, fmt.Errorf("%s: no inode information", path)
+	}
+	return uint64(st.Dev), st.Ino, nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the volume serial number and file index of the file path
+// refers to, following symlinks. They play the role of the device and inode
+// numbers on Windows.
+func fileID(path string) (device, inode uint64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(f.Fd()), &d); err != nil {
+		return 0, 0, &os.PathError{Op: "GetFileInformationByHandle", Path: path, Err: err}
+	}
+	return uint64(d.VolumeSerialNumber), uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow), nil
+}
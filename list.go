@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// runList prints the command names available in the search directories, or
+// with --prefix only those starting with it, one per line. With
+// --completion-cache the names come from the cache file while it is fresh,
+// and the cache is rebuilt when it is not.
+func runList(w io.Writer, opts *options) int {
+	names, ok := readCompletionCache(opts.completionCache, opts)
+	if !ok {
+		names = listExecutables(opts)
+		if opts.completionCache != "" {
+			if err := writeCompletionCache(opts.completionCache, names, opts); err != nil {
+				opts.warnf("%v", err)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !hasNamePrefix(name, opts.prefix) {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, name); err != nil {
+			_, _ = fmt.Fprintln(opts.stderr, err)
+			return exitFailure
+		}
+	}
+
+	if opts.warnCaseDupes {
+		for _, group := range caseDupes(opts) {
+			opts.warnf("commands differ only in case: %s", strings.Join(group, ", "))
+		}
+	}
+	return 0
+}
+
+// caseDupes returns the groups of command names in the search directories
+// that differ only in case, such as foo and FOO, for --warn-case-dupes. They
+// are distinct commands on a case-sensitive filesystem but one on a
+// case-insensitive one. Each spelling is given once, in search order, with
+// the directory it is first found in; the same spelling in two directories
+// is ordinary shadowing and not reported.
+func caseDupes(opts *options) [][]string {
+	extensions := getExtensions(opts)
+	var keys []string
+	spellings := make(map[string][]string)
+	seen := make(map[string]bool)
+
+	walkSearchDirs(opts, func(root, dir string) bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+		for _, entry := range entries {
+			name := commandName(entry.Name(), extensions)
+			if len(extensions) > 0 && name == entry.Name() {
+				continue
+			}
+			if seen[name] || !hasNamePrefix(name, opts.prefix) || !isExecutable(filepath.Join(dir, entry.Name()), opts) {
+				continue
+			}
+			seen[name] = true
+			key := strings.ToLower(name)
+			if spellings[key] == nil {
+				keys = append(keys, key)
+			}
+			spellings[key] = append(spellings[key], fmt.Sprintf("%s (%s)", name, dir))
+		}
+		return false
+	})
+
+	var groups [][]string
+	for _, key := range keys {
+		if len(spellings[key]) > 1 {
+			groups = append(groups, spellings[key])
+		}
+	}
+	return groups
+}
+
+// listExecutables returns the sorted, de-duplicated command names of the
+// executables in the search directories. On Windows only files with a
+// PATHEXT extension count, and names are listed without it.
+func listExecutables(opts *options) []string {
+	var names []string
+	walkExecutables(opts, func(root, name string) {
+		names = append(names, name)
+	})
+
+	slices.Sort(names)
+	return names
+}
+
+// walkExecutables calls visit with the command name of each executable in
+// the search directories, and the search directory it is first found in.
+// Names shadowed by an earlier directory are skipped.
+func walkExecutables(opts *options, visit func(root, name string)) {
+	extensions := getExtensions(opts)
+	seen := make(map[string]bool)
+
+	walkSearchDirs(opts, func(root, dir string) bool {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return false
+		}
+
+		for _, entry := range entries {
+			name := commandName(entry.Name(), extensions)
+			if len(extensions) > 0 && name == entry.Name() {
+				continue
+			}
+			key := name
+			if runtime.GOOS == "windows" {
+				key = strings.ToLower(name)
+			}
+			if seen[key] || !isExecutable(filepath.Join(dir, entry.Name()), opts) {
+				continue
+			}
+			seen[key] = true
+			visit(root, name)
+		}
+		return false
+	})
+}
+
+// runListSummary prints, for --list --summary, how many commands each search
+// directory contributes, shadowed names not counted again, followed by the
+// total number of distinct commands. --prefix limits the names counted.
+func runListSummary(w io.Writer, opts *options) int {
+	counts := make(map[string]int)
+	total := 0
+	walkExecutables(opts, func(root, name string) {
+		if hasNamePrefix(name, opts.prefix) {
+			counts[root]++
+			total++
+		}
+	})
+
+	var b strings.Builder
+	for _, dir := range searchDirs(opts) {
+		fmt.Fprintf(&b, "%d\t%s\n", counts[dir], dir)
+	}
+	fmt.Fprintf(&b, "%d\ttotal\n", total)
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		_, _ = fmt.Fprintln(opts.stderr, err)
+		return exitFailure
+	}
+	return 0
+}
+
+func hasNamePrefix(name, prefix string) bool {
+	if runtime.GOOS == "windows" {
+		return len(name) >= len(prefix) && strings.EqualFold(name[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(name, prefix)
+}
+
+// completionCacheHeader starts every completion cache file. It is followed
+// by one "dir" line per search directory with its modification time, a
+// "--" line, and the command names.
+const completionCacheHeader = "which completion cache v1"
+
+// cacheStamps records the search directories and their modification times.
+// A directory that is added, removed or has files added or removed changes
+// the stamps and so invalidates the cache.
+func cacheStamps(opts *options) []string {
+	var stamps []string
+	for _, dir := range searchDirs(opts) {
+		mtime := int64(-1)
+		if info, err := os.Stat(dir); err == nil {
+			mtime = info.ModTime().UnixNano()
+		}
+		stamps = append(stamps, fmt.Sprintf("dir\t%d\t%s", mtime, dir))
+	}
+	return stamps
+}
+
+// writeCompletionCache writes names to the cache file at path, stamped with
+// the current state of the search directories.
+func writeCompletionCache(path string, names []string, opts *options) error {
+	var b strings.Builder
+	b.WriteString(completionCacheHeader + "\n")
+	for _, stamp := range cacheStamps(opts) {
+		b.WriteString(stamp + "\n")
+	}
+	b.WriteString("--\n")
+	for _, name := range names {
+		b.WriteString(name + "\n")
+	}
+
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("writing completion cache: %w", err)
+	}
+	return nil
+}
+
+// readCompletionCache returns the names in the cache file at path, and
+// false if there is no such file or it is stale.
+func readCompletionCache(path string, opts *options) ([]string, bool) {
+	if path == "" {
+		return nil, false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() || scanner.Text() != completionCacheHeader {
+		return nil, false
+	}
+
+	stamps := cacheStamps(opts)
+	for i := 0; ; i++ {
+		if !scanner.Scan() {
+			return nil, false
+		}
+		line := scanner.Text()
+		if line == "--" {
+			if i != len(stamps) {
+				return nil, false
+			}
+			break
+		}
+		if i >= len(stamps) || line != stamps[i] {
+			return nil, false
+		}
+	}
+
+	var names []string
+	for scanner.Scan() {
+		names = append(names, scanner.Text())
+	}
+	if scanner.Err() != nil {
+		return nil, false
+	}
+	return names, true
+}
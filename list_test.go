@@ -0,0 +1,256 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestList(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	for _, name := range []string{"gofmt", "go", "make"} {
+		if err := os.WriteFile(filepath.Join(binDir, name+exe), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(binDir, "notes.txt"), []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	list := func(t *testing.T, args ...string) string {
+		t.Helper()
+		var stdout, stderr strings.Builder
+		if code := run(args, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		return stdout.String()
+	}
+
+	t.Run("lists sorted names", func(t *testing.T) {
+		if result := list(t, "--list"); result != "go\ngofmt\nmake\n" {
+			t.Errorf("Expected go, gofmt and make, got %q", result)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		if result := list(t, "--prefix", "go"); result != "go\ngofmt\n" {
+			t.Errorf("Expected go and gofmt, got %q", result)
+		}
+	})
+
+	cache := filepath.Join(tmpDir, "completion")
+
+	t.Run("build cache", func(t *testing.T) {
+		list(t, "--build-completion-cache", cache)
+		data, err := os.ReadFile(cache)
+		if err != nil {
+			t.Fatalf("Failed to read cache: %v", err)
+		}
+		if !strings.HasSuffix(string(data), "--\ngo\ngofmt\nmake\n") {
+			t.Errorf("Expected the names at the end of the cache, got %q", data)
+		}
+	})
+
+	t.Run("fresh cache is used", func(t *testing.T) {
+		data, err := os.ReadFile(cache)
+		if err != nil {
+			t.Fatalf("Failed to read cache: %v", err)
+		}
+		if err := os.WriteFile(cache, append(data, "gocached\n"...), 0644); err != nil {
+			t.Fatalf("Failed to write cache: %v", err)
+		}
+		if result := list(t, "--completion-cache", cache, "--prefix", "goc"); result != "gocached\n" {
+			t.Errorf("Expected the cached name, got %q", result)
+		}
+	})
+
+	t.Run("stale cache is rebuilt", func(t *testing.T) {
+		later := time.Now().Add(time.Hour)
+		if err := os.Chtimes(binDir, later, later); err != nil {
+			t.Fatalf("Failed to touch dir: %v", err)
+		}
+		if result := list(t, "--completion-cache", cache, "--prefix", "goc"); result != "" {
+			t.Errorf("Expected the stale cache to be ignored, got %q", result)
+		}
+		data, err := os.ReadFile(cache)
+		if err != nil {
+			t.Fatalf("Failed to read cache: %v", err)
+		}
+		if strings.Contains(string(data), "gocached") {
+			t.Errorf("Expected the cache to be rebuilt, got %q", data)
+		}
+	})
+}
+
+func TestListSummary(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	files := map[string][]string{
+		"local": {"go", "make"},
+		"bin":   {"go", "gofmt", "ls", "cat"},
+		"empty": nil,
+	}
+	var dirs []string
+	for _, name := range []string{"local", "bin", "empty"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		for _, file := range files[name] {
+			if err := os.WriteFile(filepath.Join(dir, file+exe), []byte("test"), 0755); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+
+	if err := os.Setenv("PATH", strings.Join(dirs, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	// --skip-dot keeps the current directory out of the counts on Windows.
+	t.Run("counts", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--list", "--summary", "--skip-dot"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		// go in bin is shadowed by local and counts only there.
+		expected := "2\t" + dirs[0] + "\n3\t" + dirs[1] + "\n0\t" + dirs[2] + "\n5\ttotal\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--prefix", "go", "--summary", "--skip-dot"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := "1\t" + dirs[0] + "\n1\t" + dirs[1] + "\n0\t" + dirs[2] + "\n2\ttotal\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("names", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--summary", "go", "foo", "ls", "bar", "gofmt"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Fatalf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		expected := "resolved 3/5 names; missing: foo, bar"
+		if last := lines[len(lines)-1]; last != expected {
+			t.Errorf("Expected %q, got %q", expected, last)
+		}
+		if strings.Count(stdout.String(), "\n") != 3 {
+			t.Errorf("Expected 3 results, got %q", stdout.String())
+		}
+	})
+
+	t.Run("names all found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--summary", "go", "ls"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if expected := "resolved 2/2 names\n"; stderr.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+}
+
+func TestWarnCaseDupes(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	files := map[string][]string{
+		"local": {"foo", "Make"},
+		"bin":   {"FOO", "make", "foo", "ls"},
+	}
+	var dirs []string
+	for _, name := range []string{"local", "bin"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		for _, file := range files[name] {
+			if runtime.GOOS != "linux" && name == "bin" && file == "foo" {
+				// FOO and foo are the same file on a case-insensitive
+				// filesystem.
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(dir, file+exe), []byte("test"), 0755); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+
+	if err := os.Setenv("PATH", strings.Join(dirs, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"--list", "--warn-case-dupes", "--skip-dot"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	// foo in bin is shadowed by foo in local and is not a case duplicate.
+	expected := "warning: commands differ only in case: Make (" + dirs[0] + "), make (" + dirs[1] + ")\n" +
+		"warning: commands differ only in case: foo (" + dirs[0] + "), FOO (" + dirs[1] + ")\n"
+	if stderr.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "ls\n") {
+		t.Errorf("Expected the list to be printed, got %q", stdout.String())
+	}
+
+	t.Run("requires --list", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--warn-case-dupes", "go"}); err == nil {
+			t.Error("Expected an error for --warn-case-dupes without --list")
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"unicode/utf16"
+)
+
+// maxLnkSize bounds the shortcut files --follow-lnk reads; real ones are a
+// few KiB.
+const maxLnkSize = 64 << 10
+
+// Shell Link header fields and flags, from [MS-SHLLINK].
+const (
+	lnkHeaderSize = 0x4c
+
+	lnkHasTargetIDList = 1 << 0
+	lnkHasLinkInfo     = 1 << 1
+	lnkHasName         = 1 << 2
+	lnkHasRelativePath = 1 << 3
+	lnkIsUnicode       = 1 << 7
+
+	lnkVolumeIDAndLocalBasePath  = 1 << 0
+	lnkCommonNetworkRelativeLink = 1 << 1
+)
+
+// lnkCLSID is the class identifier every shortcut header carries,
+// 00021401-0000-0000-C000-000000000046 in its on-disk byte order.
+var lnkCLSID = []byte{0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+
+var errNotShortcut = errors.New("not a shell link")
+
+// lnkTarget returns the path a Windows shortcut (.lnk) file points to: the
+// local or network path recorded in its link info, or else its relative
+// path, taken relative to the shortcut's directory. The Shell Link format is
+// parsed directly, so no COM is needed and shortcuts can be read anywhere.
+func lnkTarget(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxLnkSize || len(data) < lnkHeaderSize ||
+		binary.LittleEndian.Uint32(data) != lnkHeaderSize || !bytes.Equal(data[4:20], lnkCLSID) {
+		return "", errNotShortcut
+	}
+
+	flags := binary.LittleEndian.Uint32(data[0x14:])
+	r := lnkReader{data: data, pos: lnkHeaderSize}
+
+	if flags&lnkHasTargetIDList != 0 {
+		r.skip(int(r.uint16()))
+	}
+
+	var target string
+	if flags&lnkHasLinkInfo != 0 {
+		start := r.pos
+		size := int(r.uint32())
+		if start+size > len(data) {
+			return "", errNotShortcut
+		}
+		target = linkInfoPath(data[start : start+size])
+		r.pos = start + size
+	}
+
+	var relative string
+	if flags&lnkHasName != 0 {
+		r.string(flags&lnkIsUnicode != 0)
+	}
+	if flags&lnkHasRelativePath != 0 {
+		relative = r.string(flags&lnkIsUnicode != 0)
+	}
+	if r.err != nil {
+		return "", errNotShortcut
+	}
+
+	switch {
+	case target != "":
+		return target, nil
+	case relative != "":
+		return filepath.Join(filepath.Dir(path), relative), nil
+	}
+	return "", errNotShortcut
+}
+
+// linkInfoPath returns the target path recorded in a LinkInfo structure,
+// preferring the Unicode fields when present.
+func linkInfoPath(info []byte) string {
+	if len(info) < 0x1c {
+		return ""
+	}
+	field := func(offset int) int { return int(binary.LittleEndian.Uint32(info[offset:])) }
+	headerSize := field(0x04)
+	flags := field(0x08)
+
+	var suffix string
+	if headerSize >= 0x24 && len(info) >= 0x24 {
+		suffix = utf16String(info, field(0x20))
+	} else {
+		suffix = ansiString(info, field(0x18))
+	}
+
+	switch {
+	case flags&lnkVolumeIDAndLocalBasePath != 0:
+		base := ansiString(info, field(0x10))
+		if headerSize >= 0x24 && len(info) >= 0x24 {
+			base = utf16String(info, field(0x1c))
+		}
+		return base + suffix
+	case flags&lnkCommonNetworkRelativeLink != 0:
+		cnrl := field(0x14)
+		if cnrl+0x0c > len(info) {
+			return ""
+		}
+		share := ansiString(info, cnrl+int(binary.LittleEndian.Uint32(info[cnrl+0x08:])))
+		if share == "" || suffix == "" {
+			return share
+		}
+		return share + `\` + suffix
+	}
+	return ""
+}
+
+// ansiString returns the NUL-terminated single-byte string at offset in b.
+func ansiString(b []byte, offset int) string {
+	if offset <= 0 || offset >= len(b) {
+		return ""
+	}
+	end := bytes.IndexByte(b[offset:], 0)
+	if end < 0 {
+		return ""
+	}
+	return string(b[offset : offset+end])
+}
+
+// utf16String returns the NUL-terminated UTF-16LE string at offset in b.
+func utf16String(b []byte, offset int) string {
+	if offset <= 0 || offset >= len(b) {
+		return ""
+	}
+	var units []uint16
+	for i := offset; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+// lnkReader reads the sequential parts of a shortcut, recording the first
+// read past the end.
+type lnkReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *lnkReader) skip(n int) {
+	if r.err == nil && r.pos+n > len(r.data) {
+		r.err = errNotShortcut
+	}
+	r.pos += n
+}
+
+func (r *lnkReader) uint16() uint16 {
+	if r.err != nil || r.pos+2 > len(r.data) {
+		r.err = errNotShortcut
+		return 0
+	}
+	v := binary.LittleEndian.Uint16(r.data[r.pos:])
+	r.pos += 2
+	return v
+}
+
+func (r *lnkReader) uint32() uint32 {
+	if r.err != nil || r.pos+4 > len(r.data) {
+		r.err = errNotShortcut
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v
+}
+
+// string reads a StringData entry: a character count followed by that many
+// UTF-16LE or single-byte characters.
+func (r *lnkReader) string(unicode bool) string {
+	n := int(r.uint16())
+	if !unicode {
+		start := r.pos
+		r.skip(n)
+		if r.err != nil {
+			return ""
+		}
+		return string(r.data[start : start+n])
+	}
+
+	start := r.pos
+	r.skip(2 * n)
+	if r.err != nil {
+		return ""
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(r.data[start+2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// shortcut builds a Shell Link file pointing to the local path target, or
+// with no target, only to the relative path relative.
+func shortcut(target, relative string) []byte {
+	var b bytes.Buffer
+	le := func(v any) { _ = binary.Write(&b, binary.LittleEndian, v) }
+
+	flags := uint32(lnkIsUnicode)
+	if target != "" {
+		flags |= lnkHasLinkInfo
+	}
+	if relative != "" {
+		flags |= lnkHasRelativePath
+	}
+	le(uint32(lnkHeaderSize))
+	b.Write(lnkCLSID)
+	le(flags)
+	b.Write(make([]byte, lnkHeaderSize-b.Len()))
+
+	if target != "" {
+		// LinkInfo with a 0x1c-byte header, an empty VolumeID, the local
+		// base path and an empty common path suffix.
+		const volumeID = 0x1c
+		const basePath = volumeID + 0x10
+		suffix := basePath + len(target) + 1
+		le(uint32(suffix + 1))
+		le(uint32(0x1c))
+		le(uint32(lnkVolumeIDAndLocalBasePath))
+		le(uint32(volumeID))
+		le(uint32(basePath))
+		le(uint32(0))
+		le(uint32(suffix))
+		le(uint32(0x10))
+		b.Write(make([]byte, 0x0c))
+		b.WriteString(target + "\x00")
+		b.WriteByte(0)
+	}
+	if relative != "" {
+		units := utf16.Encode([]rune(relative))
+		le(uint16(len(units)))
+		le(units)
+	}
+	return b.Bytes()
+}
+
+func TestLnkTarget(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{"local path", shortcut(`C:\Program Files\Tool\tool.exe`, ""), `C:\Program Files\Tool\tool.exe`},
+		{"local path wins over relative path", shortcut(`C:\Tool\tool.exe`, `other.exe`), `C:\Tool\tool.exe`},
+		{"relative path", shortcut("", "tool.exe"), filepath.Join(tmpDir, "tool.exe")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "-")+".lnk")
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatalf("Failed to create shortcut: %v", err)
+			}
+			target, err := lnkTarget(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if target != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, target)
+			}
+		})
+	}
+
+	t.Run("not a shortcut", func(t *testing.T) {
+		for _, content := range [][]byte{[]byte("MZ not a shortcut"), shortcut(`C:\tool.exe`, "")[:lnkHeaderSize+8]} {
+			path := filepath.Join(tmpDir, "bad.lnk")
+			if err := os.WriteFile(path, content, 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			if target, err := lnkTarget(path); err == nil {
+				t.Errorf("Expected an error, got %s", target)
+			}
+		}
+	})
+}
+
+func TestFollowLnk(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Shortcuts are followed only on Windows")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	installDir := filepath.Join(tmpDir, "install")
+	linksDir := filepath.Join(tmpDir, "links")
+	for _, dir := range []string{installDir, linksDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	testExe := filepath.Join(installDir, "tool.exe")
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(linksDir, "tool.lnk"), shortcut(testExe, ""), 0644); err != nil {
+		t.Fatalf("Failed to create shortcut: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(linksDir, "readme.lnk"), shortcut(filepath.Join(installDir, "readme.txt"), ""), 0644); err != nil {
+		t.Fatalf("Failed to create shortcut: %v", err)
+	}
+
+	if err := os.Setenv("PATH", linksDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	if result := findExecutable("tool", &options{followLnk: true}); !strings.EqualFold(result, testExe) {
+		t.Errorf("Expected %s, got %s", testExe, result)
+	}
+	if result := findExecutable("tool", &options{}); result != "" {
+		t.Errorf("Expected no match without --follow-lnk, got %s", result)
+	}
+	if result := findExecutable("readme", &options{followLnk: true}); result != "" {
+		t.Errorf("Expected no match for a shortcut to a document, got %s", result)
+	}
+}
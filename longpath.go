@@ -0,0 +1,36 @@
+package main
+
+import "strings"
+
+// maxShortPath is the length from which Windows paths need the \\?\ prefix.
+// MAX_PATH is 260, but directories are limited to 248 characters so that an
+// 8.3 file name still fits.
+const maxShortPath = 248
+
+// extendedPath returns the \\?\ form of the absolute Windows path if it is
+// too long for the plain Win32 APIs, and path otherwise. The os package
+// already does this for os.Stat, os.Open and os.ReadDir, but EvalSymlinks
+// calls FindFirstFile directly to recover casing. path must be clean, since
+// the prefix turns off the system's own normalization.
+func extendedPath(path string) string {
+	if len(path) < maxShortPath || strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	path = strings.ReplaceAll(path, "/", `\`)
+	switch {
+	case strings.HasPrefix(path, `\\`):
+		return `\\?\UNC\` + path[2:]
+	case isWindowsPath(path):
+		return `\\?\` + path
+	}
+	return path
+}
+
+// trimExtendedPrefix undoes extendedPath, so results print the way they
+// would in PATH.
+func trimExtendedPrefix(path string) string {
+	if rest, ok := strings.CutPrefix(path, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	return strings.TrimPrefix(path, `\\?\`)
+}
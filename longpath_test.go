@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestExtendedPath(t *testing.T) {
+	long := strings.Repeat(`\nested`, 40)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"short path", `C:\tools\prog.exe`, `C:\tools\prog.exe`},
+		{"long drive path", `C:` + long, `\\?\C:` + long},
+		{"long path with forward slashes", `C:` + strings.ReplaceAll(long, `\`, "/"), `\\?\C:` + long},
+		{"long UNC path", `\\server\share` + long, `\\?\UNC\server\share` + long},
+		{"already extended", `\\?\C:` + long, `\\?\C:` + long},
+		{"device path", `\\.\pipe` + long, `\\.\pipe` + long},
+		{"long relative path", `tools` + long, `tools` + long},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := extendedPath(tt.input); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, path := range []string{`C:` + long, `\\server\share` + long} {
+			if result := trimExtendedPrefix(extendedPath(path)); result != path {
+				t.Errorf("Expected %s, got %s", path, result)
+			}
+		}
+	})
+}
+
+func TestFindInLongDir(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("MAX_PATH is Windows-specific")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	dir := tmpDir
+	for len(dir) < 300 {
+		dir = filepath.Join(dir, "a-rather-long-directory-name")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	prog := filepath.Join(dir, "prog.exe")
+	if err := os.WriteFile(prog, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	result := findInDir(dir, "prog", &options{})
+	if result != prog {
+		t.Errorf("Expected %s, got %s", prog, result)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// linkLoopErrors are stat failures of a path whose symlinks form a cycle or
+// chain too deep to follow.
+var linkLoopErrors = []error{syscall.ELOOP}
@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// linkLoopErrors are stat failures of a path whose symlinks form a cycle or
+// chain too deep to follow.
+var linkLoopErrors = []error{
+	syscall.Errno(1921), // ERROR_CANT_RESOLVE_FILENAME
+}
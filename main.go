@@ -1,149 +1,1499 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"unicode"
 )
 
+const (
+	exitNotFound = 1
+	exitUsage    = 2
+	exitFailure  = 1 // a check failed or output could not be written
+
+	// exitPermissionDenied is the shell's status for a command that was
+	// found but cannot be executed.
+	exitPermissionDenied = 126
+
+	// exitSymlinkLoop is the status for a name whose candidate is a
+	// symlink cycle, which the system refuses to follow.
+	exitSymlinkLoop = 3
+)
+
+// version is set at build time by goreleaser.
+var version = "dev"
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintln(os.Stderr, "Usage: which <program>")
-		os.Exit(1)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) (code int) {
+	opts, err := parseArgs(args)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		_, _ = fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	opts.stderr = stderr
+	if opts.showProgress {
+		opts.progress = newProgress(stderr)
+	}
+
+	if opts.help {
+		_, _ = fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	if opts.version {
+		_, _ = fmt.Fprintf(stdout, "which %s\n", version)
+		return 0
+	}
+
+	if opts.outputFile != "" {
+		f, err := openOutputFile(opts)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				_, _ = fmt.Fprintln(stderr, err)
+				code = max(code, exitFailure)
+			}
+		}()
+		stdout = f
+	}
+
+	if opts.envFile != "" {
+		if err := applyEnvFile(opts); err != nil {
+			_, _ = fmt.Fprintf(stderr, "reading env file: %v\n", err)
+			return exitFailure
+		}
+	}
+
+	if opts.fromDirenv {
+		if err := applyDirenv(opts); err != nil && !opts.silent {
+			opts.warnf("--from-direnv: %v; using PATH from the environment", err)
+		}
+	}
+
+	if !opts.noArgfile {
+		names, err := expandArgFiles(opts.names[:opts.flagNames])
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "reading names: %v\n", err)
+			return exitFailure
+		}
+		opts.names = append(names, opts.names[opts.flagNames:]...)
+	}
+
+	if opts.stdinNames {
+		sep := byte('\n')
+		if opts.nullIO {
+			sep = 0
+		}
+		names, err := readNames(stdin, sep)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "reading names: %v\n", err)
+			return exitFailure
+		}
+		opts.names = append(opts.names, names...)
+	}
+
+	if opts.whatname != "" {
+		return runWhatname(stdout, opts.whatname, opts)
+	}
+
+	if opts.buildCompletionCache != "" {
+		if err := writeCompletionCache(opts.buildCompletionCache, listExecutables(opts), opts); err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		return 0
+	}
+
+	if opts.list && opts.summary {
+		return runListSummary(stdout, opts)
+	}
+
+	if opts.list {
+		return runList(stdout, opts)
+	}
+
+	if opts.listPath {
+		return runListPath(stdout, opts)
+	}
+
+	if opts.showPath {
+		for _, dir := range searchDirs(opts) {
+			_, _ = fmt.Fprintln(stdout, dir)
+		}
+		return 0
+	}
+
+	if opts.pathextOrder {
+		printPathExtOrder(stdout, opts)
+		return 0
+	}
+
+	if opts.audit {
+		return runAudit(stdout, opts)
+	}
+
+	if len(opts.names) == 0 {
+		_, _ = fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+
+	if opts.verbose && runtime.GOOS == "windows" {
+		_, problems := parseExtensions(pathExtEnv(opts))
+		for _, problem := range problems {
+			opts.warnf("PATHEXT: %s", problem)
+		}
+	}
+
+	path, _ := pathEnv(opts)
+	pathDirs := filepath.SplitList(path)
+	for _, dir := range opts.onlyDirs {
+		if !containsDir(pathDirs, dir) {
+			opts.warnf("%s is not in PATH, searching it anyway", dir)
+		}
+	}
+	if opts.verbose {
+		if opts.badFormatEnv != "" {
+			opts.warnf("unknown WHICH_FORMAT %q, expected one of: %s", opts.badFormatEnv, strings.Join(outputFormats, ", "))
+		}
+		for _, ext := range opts.badExtEnv {
+			opts.warnf("WHICH_EXT: ignoring malformed entry %q: expected a dot followed by a name such as .sh", ext)
+		}
+		for _, dir := range pathDirs {
+			if hasControlChars(dir) {
+				opts.warnf("PATH entry %q contains control characters, skipping it", dir)
+			}
+			if isFileEntry(dir) {
+				opts.warnf("PATH entry %s is not a directory, skipping it", dir)
+			}
+		}
+	}
+
+	if opts.dryPaths {
+		for _, name := range opts.names {
+			for _, path := range allCandidatePaths(name, opts) {
+				_, _ = fmt.Fprintln(stdout, path)
+			}
+		}
+		return 0
+	}
+
+	if opts.readAlias {
+		aliases, err := readAliases(stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "reading aliases: %v\n", err)
+			return exitFailure
+		}
+		opts.aliases = aliases
+	}
+
+	if opts.typeA {
+		return runTypeA(stdin, stdout, stderr, opts)
+	}
+
+	if opts.beside != "" {
+		dir, err := besideDir(opts)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return exitNotFound
+		}
+		opts.dir = dir
+	}
+
+	if opts.explain {
+		return runExplain(stdout, opts)
+	}
+
+	if opts.extSummary {
+		return runExtSummary(stdout, opts)
+	}
+
+	if opts.minDirs > 0 {
+		return runMinDirs(stdout, opts)
+	}
+
+	if opts.watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return runWatch(ctx, stdout, stderr, opts)
+	}
+
+	if opts.cache != "" {
+		c, err := loadDirCache(opts.cache)
+		if err != nil && opts.verbose {
+			opts.warnf("%v, rebuilding it", err)
+		}
+		opts.dirCache = c
 	}
 
-	name := os.Args[1]
-	path := findExecutable(name)
+	status := 0
+	var results []result
+	resolved := make(map[string]bool)
+	for _, setOpts := range searchSets(opts) {
+		if opts.firstOf {
+			found, code := lookupFirstOf(stderr, setOpts)
+			status = max(status, code)
+			results = append(results, found...)
+			continue
+		}
+		if len(opts.anyOf) > 0 {
+			found, code := lookupAnyOf(stderr, setOpts)
+			status = max(status, code)
+			results = append(results, found...)
+			continue
+		}
+		for _, name := range opts.names {
+			found, code := lookupName(stderr, name, setOpts)
+			status = max(status, code)
+			results = append(results, found...)
+			if code == 0 {
+				resolved[name] = true
+			}
+		}
+	}
+
+	if opts.dirCache != nil {
+		if err := opts.dirCache.save(opts.cache); err != nil {
+			opts.warnf("%v", err)
+		}
+	}
+
+	if opts.detectHardlinks {
+		markHardlinks(results)
+	}
+	if opts.uniqueFiles {
+		results = uniqueFiles(results)
+	}
+	if opts.order != "" {
+		sortResults(results, opts.order)
+	}
+	// --path-append prints a command for a shell, which needs the real
+	// directory rather than one shortened with ~ or made relative.
+	for i := range results {
+		if results[i].Found && !opts.pathAppend {
+			abbreviate(&results[i], opts)
+		}
+	}
 
+	if opts.silent {
+		return status
+	}
+
+	if err := render(stdout, results, opts); err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+	if opts.summary && !opts.firstOf && len(opts.anyOf) == 0 {
+		printNameSummary(stderr, resolved, opts)
+	}
+
+	return status
+}
+
+// printNameSummary prints the --summary trailer for name lookups: how many
+// of the names resolved and which did not, e.g.
+// "resolved 3/5 names; missing: foo, bar". A name given twice counts twice.
+func printNameSummary(stderr io.Writer, resolved map[string]bool, opts *options) {
+	var missing []string
+	for _, name := range opts.names {
+		if !resolved[name] {
+			missing = append(missing, name)
+		}
+	}
+	line := fmt.Sprintf("resolved %d/%d names", len(opts.names)-len(missing), len(opts.names))
+	if len(missing) > 0 {
+		line += "; missing: " + strings.Join(missing, ", ")
+	}
+	_, _ = fmt.Fprintln(stderr, line)
+}
+
+// besideDir returns the directory to search with --beside: that of the
+// anchor program, with symlinks resolved so a tool linked onto PATH leads to
+// the directory it was installed in.
+func besideDir(opts *options) (string, error) {
+	path := findExecutable(opts.beside, opts)
 	if path == "" {
-		fmt.Fprintf(os.Stderr, "%s not found in PATH\n", name)
-		os.Exit(1)
+		return "", fmt.Errorf("--beside: %s not found in PATH", opts.beside)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Dir(path), nil
+}
+
+// openOutputFile opens the --output-file for writing, truncating it unless
+// --append is given.
+func openOutputFile(opts *options) (*os.File, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.appendOutput {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	return os.OpenFile(opts.outputFile, flag, 0644)
+}
+
+// lookupName looks up one name and prepares its results for output,
+// reporting a name that is not found or fails --assert on stderr. It also
+// returns the exit status for the name.
+func lookupName(stderr io.Writer, name string, opts *options) ([]result, int) {
+	found := lookup(name, opts)
+	for i := range found {
+		found[i].Set = opts.setName
+	}
+
+	if !found[0].Found {
+		reason := notFoundReason(name, opts)
+		found[0].Reason = reasonCode(reason)
+		where := "PATH"
+		if opts.setName != "" {
+			where = opts.setName
+		}
+		if !opts.silent {
+			switch {
+			case errors.Is(reason, errForeignPath):
+				_, _ = fmt.Fprintf(stderr, "%s %v\n", name, reason)
+			case errors.Is(reason, errPermissionDenied), errors.Is(reason, errBrokenAlternatives), errors.Is(reason, errSymlinkLoop), errors.Is(reason, errScriptSkipped):
+				_, _ = fmt.Fprintf(stderr, "%s: %v\n", name, reason)
+			default:
+				_, _ = fmt.Fprintf(stderr, "%s not found in %s\n", name, where)
+			}
+			// The name was looked up literally; a pattern was most
+			// likely meant.
+			if !opts.glob && strings.ContainsAny(name, "*?[") {
+				_, _ = fmt.Fprintf(stderr, "%s contains wildcard characters; did you mean --glob?\n", name)
+			}
+		}
+		if errors.Is(reason, errPermissionDenied) {
+			return found, exitPermissionDenied
+		}
+		if errors.Is(reason, errSymlinkLoop) {
+			return found, exitSymlinkLoop
+		}
+		return found, opts.notFoundStatus()
+	}
+
+	if opts.assert != "" && !checkAssert(stderr, name, found[0].Path, opts) {
+		return nil, exitFailure
+	}
+	if opts.realpathOnly {
+		for _, r := range found {
+			if r.Path != "" && !checkCanonical(stderr, name, r.Path) {
+				return nil, exitFailure
+			}
+		}
+	}
+
+	if opts.firstDir {
+		found = found[:1]
+	}
+	annotate(stderr, found, opts)
+
+	if len(opts.requireDirs) > 0 && !checkRequireDir(stderr, name, found[0], opts) {
+		return nil, exitFailure
+	}
+	return found, 0
+}
+
+// annotate applies the per-match options to found: it rewrites the path
+// for --unc and --resolve and adds the --trace-links, --inode,
+// --print-checksum, --unshim and --unwrap details, printing --why lines to
+// stderr. An alias whose command is not on PATH has no file to describe and
+// only gets its --why lines.
+func annotate(stderr io.Writer, found []result, opts *options) {
+	for i := range found {
+		if found[i].Path != "" {
+			annotateFile(&found[i], opts)
+		}
+		if opts.why {
+			printWhy(stderr, found[i], opts)
+		}
+	}
+}
+
+// annotateFile applies the per-match options that describe the file at
+// r.Path.
+func annotateFile(r *result, opts *options) {
+	if opts.unc {
+		r.Path = uncPath(r.Path)
+	}
+	if opts.resolve {
+		resolveResult(r, opts)
+	}
+	if opts.traceLinks {
+		r.Links = traceLinks(r.Path)
+	}
+	if opts.inode {
+		device, inode, err := fileID(r.Path)
+		if err != nil {
+			opts.warnf("%v", err)
+		}
+		r.Device, r.Inode = device, inode
+	}
+	if opts.checksum != "" {
+		sum, err := fileChecksum(r.Path, opts.checksum)
+		if err != nil {
+			opts.warnf("%v", err)
+		}
+		r.Checksum = sum
+	}
+	if opts.unshim {
+		r.Shim = detectShim(r.Path)
+	}
+	if opts.unwrap && r.Shim != "" {
+		target, err := unwrapShim(r.Shim, r.Path, opts)
+		if err != nil {
+			opts.warnf("cannot unwrap %s: %v", r.Path, err)
+		}
+		r.Unwrapped = target
+	}
+}
+
+// lookupFirstOf looks up the names in order and returns the results of the
+// first one that is found. Names that are not found are not reported on
+// their own; if none is found, a single error names them all.
+func lookupFirstOf(stderr io.Writer, opts *options) ([]result, int) {
+	quiet := *opts
+	quiet.silent = true
+	for _, name := range opts.names {
+		if found, code := lookupName(stderr, name, &quiet); code == 0 {
+			return found, 0
+		}
+	}
+
+	return nil, reportNoneFound(stderr, opts)
+}
+
+// lookupAnyOf looks up every --any-of pattern and returns the union of their
+// matches, each path once, sorted by name. Like lookupFirstOf, it reports
+// only when no pattern matches.
+func lookupAnyOf(stderr io.Writer, opts *options) ([]result, int) {
+	quiet := *opts
+	quiet.silent = true
+
+	var results []result
+	seen := make(map[string]bool)
+	for _, pattern := range opts.names {
+		found, code := lookupName(stderr, pattern, &quiet)
+		if code != 0 {
+			continue
+		}
+		for _, r := range found {
+			if !seen[r.Path] {
+				seen[r.Path] = true
+				results = append(results, r)
+			}
+		}
+	}
+	if len(results) == 0 {
+		return nil, reportNoneFound(stderr, opts)
+	}
+
+	sortResults(results, "name")
+	return results, 0
+}
+
+// reportNoneFound reports that none of the names was found and returns the
+// exit status for it.
+func reportNoneFound(stderr io.Writer, opts *options) int {
+	if !opts.silent {
+		where := "PATH"
+		if opts.setName != "" {
+			where = opts.setName
+		}
+		_, _ = fmt.Fprintf(stderr, "none of %s found in %s\n", strings.Join(opts.names, ", "), where)
+	}
+	return opts.notFoundStatus()
+}
+
+// searchSets returns the options to search each --path-set with, in order,
+// or just opts without --path-set. Matches from a set always carry their
+// source, so the directory within the set is known.
+func searchSets(opts *options) []*options {
+	if len(opts.pathSets) == 0 {
+		return []*options{opts}
+	}
+
+	var sets []*options
+	for _, set := range opts.pathSets {
+		setOpts := *opts
+		setOpts.path = &set.path
+		setOpts.setName = set.name
+		setOpts.printSource = true
+		sets = append(sets, &setOpts)
+	}
+	return sets
+}
+
+// readNames reads program names from r, separated by sep. A trailing
+// carriage return is dropped from newline-separated names, and empty names
+// are skipped.
+func readNames(r io.Reader, sep byte) ([]string, error) {
+	var names []string
+	br := bufio.NewReader(r)
+	for {
+		name, err := br.ReadString(sep)
+		name = strings.TrimSuffix(name, string(sep))
+		if sep == '\n' {
+			name = strings.TrimSuffix(name, "\r")
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+	}
+}
+
+// expandArgFiles replaces each @file name with the names listed in file, one
+// per line. Surrounding whitespace is trimmed, and blank lines and lines
+// starting with # are skipped.
+func expandArgFiles(names []string) ([]string, error) {
+	var expanded []string
+	for _, name := range names {
+		file, ok := strings.CutPrefix(name, "@")
+		if !ok || file == "" {
+			expanded = append(expanded, name)
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for line := range strings.Lines(string(data)) {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			expanded = append(expanded, line)
+		}
+	}
+	return expanded, nil
+}
+
+// lookup returns the matches for name: the first one, or all of them with
+// --all. A name that is not found yields a single result with Found unset.
+func lookup(name string, opts *options) []result {
+	if value, ok := opts.aliases[name]; ok {
+		r := result{Name: name, Found: true, Alias: formatAlias(name, value)}
+		if opts.why {
+			r.Why = []string{"alias read from stdin (--read-alias)"}
+		}
+		if command := aliasCommand(value); command != "" && command != name {
+			r.Path = findExecutable(command, opts)
+		} else {
+			r.Path = findExecutable(name, opts)
+		}
+		return []result{r}
+	}
+
+	var matches []match
+	if opts.glob {
+		matches = globExecutables(name, opts)
+	} else {
+		matches = findMatches(name, opts, opts.all)
 	}
 
-	fmt.Println(path)
+	if len(matches) == 0 {
+		if opts.anyFile && (opts.dir != "" || isPath(name)) {
+			if path := findAnyFile(name, opts); path != "" {
+				return []result{{Name: name, Found: true, Path: path, NotExecutable: true}}
+			}
+		}
+		return []result{{Name: name}}
+	}
+
+	results := make([]result, len(matches))
+	for i, m := range matches {
+		results[i] = result{Name: name, Found: true, Path: m.path}
+		if opts.glob {
+			results[i].Name = commandName(m.path, getExtensions(opts))
+		}
+		if opts.printSource {
+			results[i].Source = m.source
+		}
+		if opts.why {
+			results[i].Why = foundWhy(name, m, opts)
+		}
+	}
+	return results
 }
 
-func getExtensions() []string {
+// maxExtensions caps how many PATHEXT entries are tried per directory, so a
+// runaway PATHEXT cannot multiply the number of stat calls without bound.
+const maxExtensions = 32
+
+// getExtensions returns the PATHEXT extensions tried on Windows, and nil
+// elsewhere.
+func getExtensions(opts *options) []string {
 	if runtime.GOOS != "windows" {
 		return nil
 	}
 
-	pathExt := os.Getenv("PATHEXT")
+	pathExt := pathExtEnv(opts)
 	if pathExt == "" {
 		return []string{".COM", ".EXE", ".BAT", ".CMD"}
 	}
 
-	exts := strings.Split(pathExt, ";")
-	var result []string
+	exts, _ := parseExtensions(pathExt)
+	return exts
+}
+
+// pathExtEnv returns the PATHEXT value to use: the --pathext value if given,
+// or the environment's. With --pathext-from-registry an empty value is
+// replaced by the one in the registry, which services may not inherit.
+func pathExtEnv(opts *options) string {
+	if opts.pathext != nil {
+		return *opts.pathext
+	}
+	pathExt := os.Getenv("PATHEXT")
+	if pathExt == "" && opts.pathextFromRegistry {
+		pathExt, _ = registryPathExt()
+	}
+	return pathExt
+}
+
+// pathExtSource names where the PATHEXT value in effect comes from: an
+// override (--pathext, --env-file or --from-direnv), the environment, the
+// registry, or the built-in default when there is none.
+func pathExtSource(opts *options) string {
+	switch {
+	case pathExtEnv(opts) == "":
+		return "default"
+	case opts.pathext != nil:
+		return "--pathext"
+	case os.Getenv("PATHEXT") != "":
+		return "PATHEXT"
+	}
+	return "registry"
+}
+
+// printPathExtOrder prints the extensions tried for a bare name, in priority
+// order, each with where it comes from. Extensions added with --ext come
+// last. Unix has no PATHEXT, so only those are printed there.
+func printPathExtOrder(w io.Writer, opts *options) {
+	exts := getExtensions(opts)
+	source := pathExtSource(opts)
 	for _, ext := range exts {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", ext, source)
+	}
+	extSource := "--ext"
+	if opts.extFromEnv {
+		extSource = "WHICH_EXT"
+	}
+	for _, ext := range searchExtensions(opts)[len(exts):] {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", ext, extSource)
+	}
+}
+
+// parseExtensions splits a PATHEXT value into its extensions, dropping empty,
+// duplicate and malformed entries and keeping at most maxExtensions. The
+// returned problems describe anything that was dropped.
+func parseExtensions(pathExt string) (exts []string, problems []string) {
+	seen := make(map[string]bool)
+	for _, ext := range strings.Split(pathExt, ";") {
 		ext = strings.TrimSpace(ext)
-		if ext != "" {
-			result = append(result, ext)
+		switch {
+		case ext == "":
+			continue
+		case !strings.HasPrefix(ext, ".") || len(ext) == 1:
+			problems = append(problems, fmt.Sprintf("ignoring malformed entry %q: missing leading dot", ext))
+			continue
+		case strings.ContainsAny(ext, `/\:`):
+			problems = append(problems, fmt.Sprintf("ignoring malformed entry %q: contains a path separator", ext))
+			continue
+		case seen[strings.ToUpper(ext)]:
+			continue
 		}
+		seen[strings.ToUpper(ext)] = true
+		exts = append(exts, ext)
 	}
-	return result
+
+	if len(exts) > maxExtensions {
+		problems = append(problems, fmt.Sprintf("%d entries, only the first %d are used", len(exts), maxExtensions))
+		exts = exts[:maxExtensions]
+	}
+	return exts, problems
 }
 
 func isPath(name string) bool {
 	return strings.ContainsAny(name, `/\`)
 }
 
-func findExecutable(name string) string {
+// isWindowsPath reports whether name is clearly a Windows absolute path: a
+// drive letter followed by a separator, or a UNC path. Unix-style absolute
+// paths are not checked for on Windows, where they are valid and rooted on
+// the current drive.
+func isWindowsPath(name string) bool {
+	if strings.HasPrefix(name, `\\`) {
+		return true
+	}
+	if len(name) < 3 || name[1] != ':' || (name[2] != '\\' && name[2] != '/') {
+		return false
+	}
+	c := name[0]
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// Sources reported by --print-source for where a match was found, besides
+// PATH[i] for the i-th PATH entry.
+const (
+	sourceExplicit = "EXPLICIT" // the name was a path
+	sourceCwd      = "CWD"      // the implicit current directory on Windows
+	sourceDir      = "DIR"      // a --dir or --only-dir directory not in PATH
+	sourceDefault  = "DEFAULT"  // the default path used when PATH is unset
+)
+
+// match is an executable found for a name, with the origin of the search
+// directory it was found in.
+type match struct {
+	path   string
+	source string
+}
+
+// findExecutable returns the first match for name, or "" if there is none.
+//
+// The lookup functions keep no package-level mutable state and only read
+// opts, so concurrent lookups are safe as long as PATH, PATHEXT and the
+// working directory are not changed while they run.
+func findExecutable(name string, opts *options) string {
+	if matches := findMatches(name, opts, false); len(matches) > 0 {
+		return matches[0].path
+	}
+	return ""
+}
+
+// findAllExecutables returns every match for name, in search order.
+func findAllExecutables(name string, opts *options) []string {
+	var paths []string
+	for _, m := range findMatches(name, opts, true) {
+		paths = append(paths, m.path)
+	}
+	return paths
+}
+
+// findMatches returns the first match for name, or every match in search
+// order if all is set.
+func findMatches(name string, opts *options, all bool) []match {
+	if isPath(name) {
+		if path := findInDir(filepath.Dir(name), filepath.Base(name), opts); path != "" {
+			// A relative result stops meaning anything once the caller
+			// changes directory, so it is made absolute unless --relative
+			// asks to keep it.
+			if !opts.relative {
+				if abs, err := filepath.Abs(path); err == nil {
+					path = abs
+				}
+			}
+			// filepath.Join drops the "./" of a relative name, which would
+			// turn ./prog into a bare name a shell looks up in PATH.
+			if !isPath(path) {
+				path = "." + string(filepath.Separator) + path
+			}
+			return []match{{path, sourceExplicit}}
+		}
+		return nil
+	}
+
+	var matches []match
+	walkSearchDirs(opts, func(root, dir string) bool {
+		if opts.dirCache != nil && !opts.dirCache.mayContain(dir, name, opts) {
+			return false
+		}
+		if path := findInDir(dir, name, opts); path != "" {
+			matches = append(matches, match{path, dirSource(root, opts)})
+			return !all
+		}
+		return false
+	})
+	return matches
+}
+
+// dirSource reports where the search directory dir came from: PATH[i] for
+// the first PATH entry naming it, CWD for the implicit current directory on
+// Windows, DEFAULT for the default path, or DIR for a directory given with
+// --dir or --only-dir that is not in PATH.
+func dirSource(dir string, opts *options) string {
+	if opts.dir != "" {
+		return sourceDir
+	}
+	if searchesCwd(opts) {
+		if cwd, err := os.Getwd(); err == nil && sameDir(dir, cwd) {
+			return sourceCwd
+		}
+	}
+	path, isDefault := pathEnv(opts)
+	for i, entry := range filepath.SplitList(path) {
+		if opts.resolveDirs {
+			entry, _ = filepath.EvalSymlinks(entry)
+		}
+		if sameDir(entry, dir) {
+			if isDefault {
+				return sourceDefault
+			}
+			return fmt.Sprintf("PATH[%d]", i)
+		}
+	}
+	return sourceDir
+}
+
+// findAnyFile looks for name the way findExecutable does in --dir and
+// explicit-path lookups, but accepts any regular file, executable or not.
+func findAnyFile(name string, opts *options) string {
+	dir := opts.dir
 	if isPath(name) {
-		return findInDir(filepath.Dir(name), filepath.Base(name))
+		dir, name = filepath.Dir(name), filepath.Base(name)
+	}
+
+	for _, path := range dirCandidates(dir, name, opts) {
+		if isRegularFile(path, opts) {
+			return path
+		}
+	}
+	return ""
+}
+
+// defaultPath is searched on Unix when PATH is unset, as execvp does.
+const defaultPath = "/usr/bin:/bin"
+
+// pathEnv returns the PATH to search and whether it is defaultPath: the
+// --path value if given, or the environment's. An unset PATH falls back to
+// defaultPath on Unix unless --no-default-path is given; a PATH set to the
+// empty string searches nothing.
+func pathEnv(opts *options) (string, bool) {
+	if opts.path != nil {
+		return *opts.path, false
+	}
+	path, ok := os.LookupEnv("PATH")
+	if ok || runtime.GOOS == "windows" || opts.noDefaultPath {
+		return path, false
+	}
+	return defaultPath, true
+}
+
+func searchDirs(opts *options) []string {
+	if opts.dir != "" {
+		return []string{opts.dir}
 	}
 
-	pathEnv := os.Getenv("PATH")
+	path, _ := pathEnv(opts)
 
 	var dirs []string
 
-	if runtime.GOOS == "windows" {
-		cwd, err := os.Getwd()
-		if err == nil {
+	cwd := ""
+	if searchesCwd(opts) {
+		if wd, err := os.Getwd(); err == nil {
+			cwd = wd
 			dirs = append(dirs, cwd)
 		}
 	}
 
-	if pathEnv != "" {
-		dirs = append(dirs, filepath.SplitList(pathEnv)...)
+	for _, dir := range filepath.SplitList(path) {
+		// An empty entry means the current directory on Unix. Windows
+		// ignores it, as exec.LookPath and PowerShell do.
+		if dir == "" && runtime.GOOS == "windows" {
+			continue
+		}
+		// Control characters come from a corrupted environment, and no
+		// real directory is meant by them.
+		if hasControlChars(dir) {
+			continue
+		}
+		// "." and an empty entry mean the current directory. It is
+		// searched by its absolute path so matches there print absolute
+		// paths too, unless --skip-dot drops the "." entry.
+		if dir == "." || dir == "" {
+			if dir == "." && opts.skipDot {
+				continue
+			}
+			wd, err := os.Getwd()
+			if err != nil {
+				continue
+			}
+			dir = wd
+		}
+		// An entry naming a file, directly or through a symlink, is a
+		// misconfiguration with nothing in it to find.
+		if isFileEntry(dir) {
+			continue
+		}
+		// The current directory was already searched first.
+		if cwd != "" {
+			if abs, err := filepath.Abs(dir); err == nil && sameDir(abs, cwd) {
+				continue
+			}
+		}
+		// A repeated entry can only find what its first occurrence did.
+		if containsDir(dirs, dir) {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+
+	if opts.skipDot || opts.skipTilde {
+		dirs = skipDirs(dirs, opts)
+	}
+
+	if len(opts.onlyDirs) > 0 {
+		dirs = restrictDirs(dirs, opts.onlyDirs)
+	}
+
+	if opts.reverse {
+		slices.Reverse(dirs)
+	}
+
+	if opts.arch != "" {
+		dirs = preferArch(dirs, opts.arch)
+	}
+
+	if opts.preferDir != "" {
+		dirs = preferDir(dirs, opts.preferDir)
+	}
+
+	if opts.noSymlinkDirs {
+		dirs = slices.DeleteFunc(dirs, isSymlink)
+	}
+
+	if opts.resolveDirs {
+		dirs = physicalDirs(dirs)
+	}
+
+	return dirs
+}
+
+func hasControlChars(s string) bool {
+	return strings.ContainsFunc(s, unicode.IsControl)
+}
+
+// searchesCwd reports whether the current directory is searched before PATH,
+// as cmd.exe does on Windows unless NoDefaultCurrentDirectoryInExePath is set.
+func searchesCwd(opts *options) bool {
+	if runtime.GOOS != "windows" || opts.skipDot {
+		return false
 	}
+	_, disabled := os.LookupEnv("NoDefaultCurrentDirectoryInExePath")
+	return !disabled
+}
+
+// skipDirs drops the directories excluded by --skip-dot and --skip-tilde.
+func skipDirs(dirs []string, opts *options) []string {
+	home, _ := os.UserHomeDir()
 
+	var result []string
 	for _, dir := range dirs {
-		path := findInDir(dir, name)
-		if path != "" {
-			return path
+		if opts.skipDot && strings.HasPrefix(dir, ".") {
+			continue
 		}
+		if opts.skipTilde && (strings.HasPrefix(dir, "~") || (home != "" && isWithin(dir, home))) {
+			continue
+		}
+		result = append(result, dir)
 	}
+	return result
+}
 
-	return ""
+// isWithin reports whether path is dir or lies below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
 }
 
-func findInDir(dir, name string) string {
-	extensions := getExtensions()
+// walkSearchDirs calls visit for each search directory in order until visit
+// returns true. With --max-depth it also visits the subdirectories of each
+// search directory, up to that many levels deep, right after the directory
+// itself. visit also gets the search directory the visited one lies in.
+// Symlinked subdirectories are not followed, but a symlinked search
+// directory is. A directory reached from two search directories, such as
+// /opt/tools under both /opt and /opt/tools, is visited only the first time.
+func walkSearchDirs(opts *options, visit func(root, dir string) bool) {
+	roots := searchDirs(opts)
+	visited := make(map[string]bool)
+	defer opts.progress.clear()
+	for i, root := range roots {
+		opts.progress.update(i+1, len(roots))
+		if opts.maxDepth == 0 {
+			if visit(root, root) {
+				return
+			}
+			continue
+		}
 
-	if len(extensions) > 0 {
-		ext := strings.ToUpper(filepath.Ext(name))
+		// WalkDir does not follow a symlinked root, such as /bin ->
+		// /usr/bin, so the walk starts from its target and the visited
+		// directories are named under the entry as written.
+		walkRoot := root
+		if isSymlink(root) {
+			if resolved, err := filepath.EvalSymlinks(root); err == nil {
+				walkRoot = resolved
+			}
+		}
 
-		for _, e := range extensions {
-			if ext == strings.ToUpper(e) {
-				path := filepath.Join(dir, name)
-				if isExecutable(path) {
-					return normalizePath(path)
+		done := false
+		_ = filepath.WalkDir(walkRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if path == walkRoot {
+				path = root
+			} else {
+				rel, err := filepath.Rel(walkRoot, path)
+				if err != nil || strings.Count(rel, string(filepath.Separator))+1 > opts.maxDepth {
+					return filepath.SkipDir
 				}
-				return ""
+				path = filepath.Join(root, rel)
+			}
+			// An overlapping search directory was already walked through
+			// this one. Its subdirectories are still walked, as they may
+			// lie beyond the depth the other walk reached.
+			key := filepath.Clean(path)
+			if runtime.GOOS == "windows" {
+				key = strings.ToLower(key)
+			}
+			if visited[key] {
+				return nil
 			}
+			visited[key] = true
+			if visit(root, path) {
+				done = true
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if done {
+			return
 		}
+	}
+}
 
-		for _, ext := range extensions {
-			path := filepath.Join(dir, name+ext)
-			if isExecutable(path) {
-				return normalizePath(path)
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// physicalDirs replaces each directory with its real path and drops the ones
+// whose real path was already seen, so PATH entries that are symlinks to the
+// same directory are searched once. Directories that cannot be resolved,
+// such as missing ones or symlink loops, are dropped.
+func physicalDirs(dirs []string) []string {
+	var result []string
+	for _, dir := range dirs {
+		realDir, err := filepath.EvalSymlinks(dir)
+		if err != nil || containsDir(result, realDir) {
+			continue
+		}
+		result = append(result, realDir)
+	}
+	return result
+}
+
+// preferArch moves the directories whose path contains arch, compared
+// case-insensitively, ahead of the others, keeping the order within each
+// group. It is a heuristic for multiarch layouts such as
+// /usr/lib/x86_64-linux-gnu/bin or /opt/homebrew/arm64/bin.
+func preferArch(dirs []string, arch string) []string {
+	arch = strings.ToLower(arch)
+	var matching, rest []string
+	for _, dir := range dirs {
+		if strings.Contains(strings.ToLower(dir), arch) {
+			matching = append(matching, dir)
+		} else {
+			rest = append(rest, dir)
+		}
+	}
+	return append(matching, rest...)
+}
+
+// preferDir moves dir to the front of dirs, adding it if dirs does not
+// contain it.
+func preferDir(dirs []string, dir string) []string {
+	rest := slices.DeleteFunc(slices.Clone(dirs), func(d string) bool { return sameDir(d, dir) })
+	return append([]string{dir}, rest...)
+}
+
+// restrictDirs keeps the entries of dirs that appear in allowed, in search
+// order, followed by any allowed directories that dirs does not contain.
+func restrictDirs(dirs, allowed []string) []string {
+	var result []string
+	for _, dir := range dirs {
+		if containsDir(allowed, dir) && !containsDir(result, dir) {
+			result = append(result, dir)
+		}
+	}
+	for _, dir := range allowed {
+		if !containsDir(result, dir) {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+// isFileEntry reports whether the PATH entry dir exists but, after following
+// symlinks, is not a directory. Entries that do not exist are not reported.
+func isFileEntry(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	info, err := os.Stat(dir)
+	return err == nil && !info.IsDir()
+}
+
+func containsDir(dirs []string, dir string) bool {
+	for _, d := range dirs {
+		if sameDir(d, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameDir(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+func findInDir(dir, name string, opts *options) string {
+	return checkCandidates(dir, name, opts, nil)
+}
+
+// verdict is what checkCandidates made of one candidate file.
+type verdict int
+
+const (
+	verdictMissing verdict = iota
+	verdictDir
+	verdictNotExecutable
+	verdictScript      // executable, but skipped by --binary-only
+	verdictExtCase     // extension spelled differently, --ext-case-sensitive
+	verdictFound       // executable
+	verdictFoundNoexec // accepted without +x by --allow-noexec-ext
+	verdictNotShortcut // a .lnk that does not point to a program
+	verdictShortcut    // a .lnk pointing to a program, --follow-lnk
+)
+
+// checkCandidates tries the candidates for name in dir in order and returns
+// the first match, or "". It is the one acceptance check behind both the
+// lookup and "which explain": report, if not nil, is told the verdict on
+// every candidate tried.
+func checkCandidates(dir, name string, opts *options, report func(path string, v verdict)) string {
+	// Finding out why a candidate was rejected costs another stat, so it
+	// is only done for a report.
+	explain := report != nil
+	if !explain {
+		report = func(string, verdict) {}
+	}
+
+	names := []string{name}
+	if opts.unicodeNormalize {
+		names = normalizationForms(name)
+	}
+
+	for _, name := range names {
+		bare := filepath.Join(dir, name)
+		for _, path := range dirCandidates(dir, name, opts) {
+			// --allow-noexec-ext accepts extension matches on Unix by
+			// name alone, so scripts run as "sh foo.sh" are found
+			// without +x.
+			v := verdictFound
+			if !isExecutable(path, opts) {
+				if !opts.allowNoexecExt || path == bare || !isRegularFile(path, opts) {
+					if explain {
+						report(path, rejectedVerdict(path, opts))
+					}
+					continue
+				}
+				v = verdictFoundNoexec
+			}
+			if opts.binaryOnly && isScript(path) {
+				report(path, verdictScript)
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				base := actualName(dir, filepath.Base(path))
+				if opts.extCaseSensitive && !hasExactExtension(base, searchExtensions(opts)) {
+					report(path, verdictExtCase)
+					continue
+				}
+				if !opts.noNormalize {
+					path = filepath.Join(dir, base)
+				}
 			}
+			report(path, v)
+			return resultPath(path, opts)
 		}
-	} else {
-		path := filepath.Join(dir, name)
-		if isExecutable(path) {
-			return normalizePath(path)
+		if opts.followLnk && runtime.GOOS == "windows" {
+			lnk := filepath.Join(dir, name+".lnk")
+			if target := shortcutTarget(lnk, opts); target != "" {
+				report(lnk, verdictShortcut)
+				return resultPath(target, opts)
+			}
+			if explain {
+				if isRegularFile(lnk, opts) {
+					report(lnk, verdictNotShortcut)
+				} else {
+					report(lnk, verdictMissing)
+				}
+			}
 		}
 	}
 
 	return ""
 }
 
-func isExecutable(path string) bool {
-	info, err := os.Stat(path)
+// rejectedVerdict tells why a candidate that is not executable was
+// rejected.
+func rejectedVerdict(path string, opts *options) verdict {
+	info, err := statRetry(path, opts.retry, os.Stat)
+	switch {
+	case err != nil:
+		return verdictMissing
+	case info.IsDir():
+		return verdictDir
+	default:
+		return verdictNotExecutable
+	}
+}
+
+// shortcutTarget returns the executable the shortcut at path points to, for
+// --follow-lnk, or "" if path is not a shortcut to a program with a PATHEXT
+// extension.
+func shortcutTarget(path string, opts *options) string {
+	target, err := lnkTarget(path)
+	if err != nil || commandName(target, searchExtensions(opts)) == filepath.Base(target) || !isExecutable(target, opts) {
+		return ""
+	}
+	return target
+}
+
+// actualName returns the directory entry of dir that name refers to on a
+// case-insensitive filesystem, so results carry the on-disk casing even when
+// the query or PATHEXT used another one.
+func actualName(dir, name string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return name
+	}
+
+	match := name
+	for _, entry := range entries {
+		if entry.Name() == name {
+			return name
+		}
+		if match == name && strings.EqualFold(entry.Name(), name) {
+			match = entry.Name()
+		}
+	}
+	return match
+}
+
+// candidatePaths lists, in order, the files findInDir checks for name in dir.
+// A name already ending in one of the extensions is tried as is; otherwise
+// each extension is appended in turn.
+func candidatePaths(dir, name string, extensions []string) []string {
+	if len(extensions) == 0 {
+		return []string{filepath.Join(dir, name)}
+	}
+
+	// A name that already has a PATHEXT extension is tried as is first, but
+	// the extensions are still appended so that names like foo.bat.exe are
+	// found, as exec.LookPath does.
+	var paths []string
+	ext := filepath.Ext(name)
+	for _, e := range extensions {
+		if strings.EqualFold(ext, e) {
+			paths = append(paths, filepath.Join(dir, name))
+			break
+		}
+	}
+
+	for _, e := range extensions {
+		paths = append(paths, filepath.Join(dir, name+e))
+	}
+	return paths
+}
+
+// dirCandidates lists the files checked for name in dir: the PATHEXT
+// candidates on Windows, and on Unix the bare name followed by name with
+// each --ext extension. On Windows --ext adds to PATHEXT.
+func dirCandidates(dir, name string, opts *options) []string {
+	extensions := searchExtensions(opts)
+	paths := candidatePaths(dir, name, extensions)
+	if runtime.GOOS != "windows" && len(extensions) > 0 {
+		if bare := filepath.Join(dir, name); paths[0] != bare {
+			paths = append([]string{bare}, paths...)
+		}
+	}
+	return paths
+}
+
+// searchExtensions returns the extensions tried for each name: PATHEXT on
+// Windows, followed by any --ext extensions it does not already contain.
+func searchExtensions(opts *options) []string {
+	extensions := getExtensions(opts)
+	for _, e := range opts.exts {
+		if !slices.ContainsFunc(extensions, func(x string) bool { return strings.EqualFold(x, e) }) {
+			extensions = append(extensions, e)
+		}
+	}
+	return extensions
+}
+
+// hasExactExtension reports whether name ends in one of extensions, spelled
+// in the same case, for --ext-case-sensitive.
+func hasExactExtension(name string, extensions []string) bool {
+	return slices.Contains(extensions, filepath.Ext(name))
+}
+
+// allCandidatePaths lists every file the search for name would check,
+// across all search directories, without touching the filesystem.
+func allCandidatePaths(name string, opts *options) []string {
+	if isPath(name) {
+		return dirCandidates(filepath.Dir(name), filepath.Base(name), opts)
+	}
+
+	var paths []string
+	for _, dir := range searchDirs(opts) {
+		paths = append(paths, dirCandidates(dir, name, opts)...)
+	}
+	return paths
+}
+
+func isRegularFile(path string, opts *options) bool {
+	info, err := statRetry(path, opts.retry, os.Stat)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func isExecutable(path string, opts *options) bool {
+	info, err := statRetry(path, opts.retry, os.Stat)
 	if err != nil || info.IsDir() {
 		return false
 	}
 
 	if runtime.GOOS != "windows" {
-		return info.Mode()&0111 != 0
+		return info.Mode()&0111 != 0 && canExecute(path)
 	}
 
 	return true
 }
 
+// resultPath returns the form of path that is reported for a match: the
+// normalizePath form, or path as joined from its search directory with
+// --no-normalize.
+func resultPath(path string, opts *options) string {
+	if opts.noNormalize {
+		return path
+	}
+	return normalizePath(path)
+}
+
+// normalizePath returns the canonical on-disk form of a Windows result:
+// symlinks and junctions resolved and casing taken from the filesystem.
+// Applying it to an already normalized path returns that path unchanged.
 func normalizePath(path string) string {
 	if runtime.GOOS == "windows" {
-		dir := filepath.Dir(path)
-		base := filepath.Base(path)
+		if rp, err := filepath.EvalSymlinks(extendedPath(path)); err == nil {
+			return trimExtendedPrefix(rp)
+		}
 
-		if target, err := os.Readlink(dir); err == nil {
-			if filepath.IsAbs(target) {
-				dir = target
-			} else {
-				dir = filepath.Join(filepath.Dir(dir), target)
-			}
+		// EvalSymlinks can fail on junctions it cannot traverse; resolve
+		// the links by hand, nested ones included, and try once more.
+		resolvedPath, ok := resolveLinks(path)
+		if !ok || resolvedPath == path {
+			return onDiskCase(path)
 		}
+		if rp, err := filepath.EvalSymlinks(extendedPath(resolvedPath)); err == nil {
+			return trimExtendedPrefix(rp)
+		}
+		return onDiskCase(resolvedPath)
+	}
+	return path
+}
 
-		resolvedPath := filepath.Join(dir, base)
+// resolveLinks replaces each link among the components of path, junctions
+// included, by its target until none is left, so a junction reached through
+// another junction is resolved too. Every replacement restarts the walk from
+// the volume root; after maxLinkHops of them the links are taken to form a
+// cycle and ok is false.
+func resolveLinks(path string) (resolved string, ok bool) {
+	for range maxLinkHops {
+		link, target, found := firstLink(path)
+		if !found {
+			return path, true
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(link), target)
+		}
+		path = filepath.Join(target, path[len(link):])
+	}
+	return path, false
+}
 
-		if rp, err := filepath.EvalSymlinks(resolvedPath); err == nil {
-			return rp
+// firstLink returns the shortest prefix of path that is a link, and its
+// target.
+func firstLink(path string) (link, target string, found bool) {
+	i := len(filepath.VolumeName(path))
+	for i < len(path) {
+		for i < len(path) && os.IsPathSeparator(path[i]) {
+			i++
+		}
+		j := i
+		for j < len(path) && !os.IsPathSeparator(path[j]) {
+			j++
 		}
-		return resolvedPath
+		if j == i {
+			break
+		}
+		if target, err := os.Readlink(path[:j]); err == nil {
+			return path[:j], target, true
+		}
+		i = j
 	}
-	return path
+	return "", "", false
+}
+
+// onDiskCase returns path with each component in its on-disk casing, for
+// the results EvalSymlinks, which normalizes casing itself, could not
+// handle. Components that cannot be read are kept as they are.
+func onDiskCase(path string) string {
+	volume := filepath.VolumeName(path)
+	rest := path[len(volume):]
+	dir := volume
+	if strings.HasPrefix(rest, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	for _, name := range strings.Split(rest, string(filepath.Separator)) {
+		if name == "" {
+			continue
+		}
+		parent := dir
+		if parent == "" {
+			parent = "."
+		}
+		dir = filepath.Join(dir, actualName(parent, name))
+	}
+	return dir
 }
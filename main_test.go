@@ -1,11 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -17,13 +22,13 @@ func TestIsExecutable(t *testing.T) {
 	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
 
 	t.Run("non-existent file returns false", func(t *testing.T) {
-		if isExecutable(filepath.Join(tmpDir, "nonexistent")) {
+		if isExecutable(filepath.Join(tmpDir, "nonexistent"), &options{}) {
 			t.Error("Expected false for non-existent file")
 		}
 	})
 
 	t.Run("directory returns false", func(t *testing.T) {
-		if isExecutable(tmpDir) {
+		if isExecutable(tmpDir, &options{}) {
 			t.Error("Expected false for directory")
 		}
 	})
@@ -35,18 +40,18 @@ func TestIsExecutable(t *testing.T) {
 		}
 
 		if runtime.GOOS == "windows" {
-			if !isExecutable(testFile) {
+			if !isExecutable(testFile, &options{}) {
 				t.Error("Expected true for regular file on Windows")
 			}
 		} else {
-			if isExecutable(testFile) {
+			if isExecutable(testFile, &options{}) {
 				t.Error("Expected false for file without execute permission")
 			}
 
 			if err := os.Chmod(testFile, 0755); err != nil {
 				t.Fatalf("Failed to chmod: %v", err)
 			}
-			if !isExecutable(testFile) {
+			if !isExecutable(testFile, &options{}) {
 				t.Error("Expected true for file with execute permission")
 			}
 		}
@@ -73,7 +78,7 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "testprog")
+			result := findInDir(tmpDir, "testprog", &options{})
 			if !strings.EqualFold(result, exeFile) {
 				t.Errorf("Expected %s, got %s", exeFile, result)
 			}
@@ -85,7 +90,7 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "script")
+			result := findInDir(tmpDir, "script", &options{})
 			if !strings.EqualFold(result, batFile) {
 				t.Errorf("Expected %s, got %s", batFile, result)
 			}
@@ -97,7 +102,7 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "script2")
+			result := findInDir(tmpDir, "script2", &options{})
 			if !strings.EqualFold(result, cmdFile) {
 				t.Errorf("Expected %s, got %s", cmdFile, result)
 			}
@@ -113,7 +118,7 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create bat file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "both")
+			result := findInDir(tmpDir, "both", &options{})
 			if !strings.EqualFold(result, exeFile) {
 				t.Errorf("Expected %s (exe preferred), got %s", exeFile, result)
 			}
@@ -125,14 +130,14 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "explicit.bat")
+			result := findInDir(tmpDir, "explicit.bat", &options{})
 			if !strings.EqualFold(result, batFile) {
 				t.Errorf("Expected %s, got %s", batFile, result)
 			}
 		})
 
 		t.Run("explicit extension not found returns empty", func(t *testing.T) {
-			result := findInDir(tmpDir, "nonexistent.exe")
+			result := findInDir(tmpDir, "nonexistent.exe", &options{})
 			if result != "" {
 				t.Errorf("Expected empty string, got %s", result)
 			}
@@ -144,7 +149,7 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "unixprog")
+			result := findInDir(tmpDir, "unixprog", &options{})
 			if !strings.EqualFold(result, exeFile) {
 				t.Errorf("Expected %s, got %s", exeFile, result)
 			}
@@ -156,7 +161,7 @@ func TestFindInDir(t *testing.T) {
 				t.Fatalf("Failed to create test file: %v", err)
 			}
 
-			result := findInDir(tmpDir, "nonexe")
+			result := findInDir(tmpDir, "nonexe", &options{})
 			if result != "" {
 				t.Errorf("Expected empty string for non-executable, got %s", result)
 			}
@@ -164,7 +169,7 @@ func TestFindInDir(t *testing.T) {
 	}
 
 	t.Run("not found returns empty string", func(t *testing.T) {
-		result := findInDir(tmpDir, "doesnotexist")
+		result := findInDir(tmpDir, "doesnotexist", &options{})
 		if result != "" {
 			t.Errorf("Expected empty string, got %s", result)
 		}
@@ -221,14 +226,14 @@ func TestFindExecutable(t *testing.T) {
 	}
 
 	t.Run("finds program in first PATH directory", func(t *testing.T) {
-		result := findExecutable("prog1")
+		result := findExecutable("prog1", &options{})
 		if !strings.EqualFold(result, testExe1) {
 			t.Errorf("Expected %s, got %s", testExe1, result)
 		}
 	})
 
 	t.Run("finds program in second PATH directory", func(t *testing.T) {
-		result := findExecutable("prog2")
+		result := findExecutable("prog2", &options{})
 		if !strings.EqualFold(result, testExe2) {
 			t.Errorf("Expected %s, got %s", testExe2, result)
 		}
@@ -245,27 +250,69 @@ func TestFindExecutable(t *testing.T) {
 			t.Fatalf("Failed to create duplicate file: %v", err)
 		}
 
-		result := findExecutable("prog1")
+		result := findExecutable("prog1", &options{})
 		if !strings.EqualFold(result, testExe1) {
 			t.Errorf("Expected first match %s, got %s", testExe1, result)
 		}
 	})
 
 	t.Run("not found returns empty string", func(t *testing.T) {
-		result := findExecutable("nonexistent")
+		result := findExecutable("nonexistent", &options{})
 		if result != "" {
 			t.Errorf("Expected empty string, got %s", result)
 		}
 	})
 
-	t.Run("empty PATH returns empty string", func(t *testing.T) {
+	t.Run("empty PATH searches nothing", func(t *testing.T) {
 		if err := os.Setenv("PATH", ""); err != nil {
 			t.Fatalf("Failed to set PATH: %v", err)
 		}
-		result := findExecutable("prog1")
+		result := findExecutable("prog1", &options{})
 		if result != "" {
 			t.Errorf("Expected empty string for empty PATH, got %s", result)
 		}
+		if runtime.GOOS != "windows" {
+			if result := findExecutable("sh", &options{}); result != "" {
+				t.Errorf("Expected empty PATH not to use the default path, got %s", result)
+			}
+		}
+	})
+}
+
+func TestUnsetPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no default path")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	if err := os.Unsetenv("PATH"); err != nil {
+		t.Fatalf("Failed to unset PATH: %v", err)
+	}
+
+	t.Run("uses the default path", func(t *testing.T) {
+		result := findExecutable("sh", &options{})
+		if result != "/usr/bin/sh" && result != "/bin/sh" {
+			t.Errorf("Expected sh from %s, got %q", defaultPath, result)
+		}
+	})
+
+	t.Run("reports the default source", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--print-source", "sh"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.HasSuffix(stdout.String(), " (DEFAULT)\n") {
+			t.Errorf("Expected DEFAULT source, got %q", stdout.String())
+		}
+	})
+
+	t.Run("no-default-path searches nothing", func(t *testing.T) {
+		result := findExecutable("sh", &options{noDefaultPath: true})
+		if result != "" {
+			t.Errorf("Expected empty string, got %s", result)
+		}
 	})
 }
 
@@ -315,7 +362,7 @@ func TestFindExecutableWithEmptyDirs(t *testing.T) {
 		t.Cleanup(func() { _ = os.Chdir(origDir) })
 	}
 
-	result := findExecutable("prog")
+	result := findExecutable("prog", &options{})
 	if !strings.EqualFold(result, testExe) {
 		t.Errorf("Expected %s, got %s", testExe, result)
 	}
@@ -324,7 +371,7 @@ func TestFindExecutableWithEmptyDirs(t *testing.T) {
 func TestGetExtensions(t *testing.T) {
 	if runtime.GOOS != "windows" {
 		t.Run("returns nil on non-Windows", func(t *testing.T) {
-			exts := getExtensions()
+			exts := getExtensions(&options{})
 			if exts != nil {
 				t.Errorf("Expected nil on non-Windows, got %v", exts)
 			}
@@ -339,7 +386,7 @@ func TestGetExtensions(t *testing.T) {
 		if err := os.Setenv("PATHEXT", ""); err != nil {
 			t.Fatalf("Failed to set PATHEXT: %v", err)
 		}
-		exts := getExtensions()
+		exts := getExtensions(&options{})
 		expected := []string{".COM", ".EXE", ".BAT", ".CMD"}
 		if len(exts) != len(expected) {
 			t.Errorf("Expected %v, got %v", expected, exts)
@@ -350,7 +397,7 @@ func TestGetExtensions(t *testing.T) {
 		if err := os.Setenv("PATHEXT", ".COM;.EXE;.BAT;.CMD;.PS1"); err != nil {
 			t.Fatalf("Failed to set PATHEXT: %v", err)
 		}
-		exts := getExtensions()
+		exts := getExtensions(&options{})
 		if len(exts) != 5 {
 			t.Errorf("Expected 5 extensions, got %d: %v", len(exts), exts)
 		}
@@ -363,7 +410,7 @@ func TestGetExtensions(t *testing.T) {
 		if err := os.Setenv("PATHEXT", ".EXE;;.BAT"); err != nil {
 			t.Fatalf("Failed to set PATHEXT: %v", err)
 		}
-		exts := getExtensions()
+		exts := getExtensions(&options{})
 		if len(exts) != 2 {
 			t.Errorf("Expected 2 extensions, got %d: %v", len(exts), exts)
 		}
@@ -418,7 +465,7 @@ func TestFindExecutableWithPath(t *testing.T) {
 	}
 
 	t.Run("finds file with explicit path", func(t *testing.T) {
-		result := findExecutable(testExe)
+		result := findExecutable(testExe, &options{})
 		if !strings.EqualFold(result, testExe) {
 			t.Errorf("Expected %s, got %s", testExe, result)
 		}
@@ -429,7 +476,7 @@ func TestFindExecutableWithPath(t *testing.T) {
 		if runtime.GOOS == "windows" {
 			nonExistent += ".exe"
 		}
-		result := findExecutable(nonExistent)
+		result := findExecutable(nonExistent, &options{})
 		if result != "" {
 			t.Errorf("Expected empty string, got %s", result)
 		}
@@ -473,7 +520,7 @@ func TestFindInCurrentDirectory(t *testing.T) {
 	}
 
 	t.Run("finds executable in current directory on Windows", func(t *testing.T) {
-		result := findExecutable("cwdprog")
+		result := findExecutable("cwdprog", &options{})
 		if !strings.EqualFold(result, testExe) {
 			t.Errorf("Expected %s, got %s", testExe, result)
 		}
@@ -497,7 +544,7 @@ func TestCaseInsensitiveExtension(t *testing.T) {
 	}
 
 	t.Run("finds file with different case extension", func(t *testing.T) {
-		result := findInDir(tmpDir, "caseprog.exe")
+		result := findInDir(tmpDir, "caseprog.exe", &options{})
 		if result == "" {
 			t.Error("Expected to find file with case-insensitive extension match")
 		}
@@ -537,14 +584,14 @@ func TestCaseSensitiveFilesystem(t *testing.T) {
 	}
 
 	t.Run("finds exact case match on case-sensitive filesystem", func(t *testing.T) {
-		result := findInDir(tmpDir, "prog")
+		result := findInDir(tmpDir, "prog", &options{})
 		if result != lowerFile {
 			t.Errorf("Expected %s, got %s", lowerFile, result)
 		}
 	})
 
 	t.Run("finds uppercase file when searching uppercase", func(t *testing.T) {
-		result := findInDir(tmpDir, "PROG")
+		result := findInDir(tmpDir, "PROG", &options{})
 		if result != upperFile {
 			t.Errorf("Expected %s, got %s", upperFile, result)
 		}
@@ -613,7 +660,7 @@ func TestJunctionResolution(t *testing.T) {
 	}
 
 	t.Run("finds executable through junction", func(t *testing.T) {
-		result := findInDir(junctionDir, "prog")
+		result := findInDir(junctionDir, "prog", &options{})
 		if result == "" {
 			t.Error("Expected to find executable through junction")
 		}
@@ -683,7 +730,7 @@ func TestFindExecutableThroughJunction(t *testing.T) {
 	t.Cleanup(func() { _ = os.Chdir(origDir) })
 
 	t.Run("finds and normalizes executable through junction in PATH", func(t *testing.T) {
-		result := findExecutable("junctionprog")
+		result := findExecutable("junctionprog", &options{})
 		if result == "" {
 			t.Fatal("Expected to find executable")
 		}
@@ -693,3 +740,2497 @@ func TestFindExecutableThroughJunction(t *testing.T) {
 		}
 	})
 }
+
+func TestOnlyDir(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir1, err := os.MkdirTemp("", "which-test1")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir1) })
+
+	tmpDir2, err := os.MkdirTemp("", "which-test2")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir2) })
+
+	offPathDir, err := os.MkdirTemp("", "which-test-off")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(offPathDir) })
+
+	if runtime.GOOS == "windows" {
+		for _, dir := range []*string{&tmpDir1, &tmpDir2, &offPathDir} {
+			if resolved, err := filepath.EvalSymlinks(*dir); err == nil {
+				*dir = resolved
+			}
+		}
+	}
+
+	exeName := "tool"
+	if runtime.GOOS == "windows" {
+		exeName = "tool.exe"
+	}
+	exe1 := filepath.Join(tmpDir1, exeName)
+	exe2 := filepath.Join(tmpDir2, exeName)
+	offPathExe := filepath.Join(offPathDir, exeName)
+	for _, exe := range []string{exe1, exe2, offPathExe} {
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir1+string(os.PathListSeparator)+tmpDir2); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("restricts search to an on-PATH directory", func(t *testing.T) {
+		result := findExecutable("tool", &options{onlyDirs: []string{tmpDir2}})
+		if !strings.EqualFold(result, exe2) {
+			t.Errorf("Expected %s, got %s", exe2, result)
+		}
+	})
+
+	t.Run("keeps PATH order for several allowed directories", func(t *testing.T) {
+		result := findExecutable("tool", &options{onlyDirs: []string{tmpDir2, tmpDir1}})
+		if !strings.EqualFold(result, exe1) {
+			t.Errorf("Expected %s, got %s", exe1, result)
+		}
+	})
+
+	t.Run("searches an off-PATH directory", func(t *testing.T) {
+		result := findExecutable("tool", &options{onlyDirs: []string{offPathDir}})
+		if !strings.EqualFold(result, offPathExe) {
+			t.Errorf("Expected %s, got %s", offPathExe, result)
+		}
+	})
+
+	t.Run("warns about an off-PATH directory", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--only-dir", offPathDir, "tool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.EqualFold(strings.TrimSpace(stdout.String()), offPathExe) {
+			t.Errorf("Expected %s, got %s", offPathExe, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "not in PATH") {
+			t.Errorf("Expected a warning about %s, got %q", offPathDir, stderr.String())
+		}
+	})
+
+	t.Run("silent does not warn", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"-s", "--only-dir", offPathDir, "tool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no warning, got %q", stderr.String())
+		}
+	})
+
+	t.Run("does not warn about an on-PATH directory", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--only-dir=" + tmpDir1, "tool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no warning, got %q", stderr.String())
+		}
+	})
+}
+
+func TestNormalizePathSymlinkedDirectory(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("normalizePath is Windows-specific")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-symlink-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	targetDir := filepath.Join(tmpDir, "target")
+	if err := os.Mkdir(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create target dir: %v", err)
+	}
+
+	testExe := filepath.Join(targetDir, "prog.exe")
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	linkDir := filepath.Join(tmpDir, "link")
+	if err := os.Symlink(targetDir, linkDir); err != nil {
+		t.Skipf("Cannot create directory symlink (requires privilege or developer mode): %v", err)
+	}
+
+	t.Run("resolves symlinked directory to target", func(t *testing.T) {
+		result := findInDir(linkDir, "prog", &options{})
+		if !strings.EqualFold(result, testExe) {
+			t.Errorf("Expected %s, got %s", testExe, result)
+		}
+	})
+
+	t.Run("is idempotent through symlinked directory", func(t *testing.T) {
+		once := normalizePath(filepath.Join(linkDir, "prog.EXE"))
+		twice := normalizePath(once)
+		if once != twice {
+			t.Errorf("Expected normalizePath to be idempotent, got %s then %s", once, twice)
+		}
+	})
+}
+
+func TestNormalizePathIdempotentThroughJunction(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Junction points are Windows-specific")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-junction-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	targetDir := filepath.Join(tmpDir, "target")
+	if err := os.Mkdir(targetDir, 0755); err != nil {
+		t.Fatalf("Failed to create target dir: %v", err)
+	}
+
+	testExe := filepath.Join(targetDir, "prog.exe")
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	junctionDir := filepath.Join(tmpDir, "junction")
+	cmd := exec.Command("cmd", "/c", "mklink", "/J", junctionDir, targetDir)
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to create junction: %v", err)
+	}
+
+	once := normalizePath(filepath.Join(junctionDir, "prog.EXE"))
+	twice := normalizePath(once)
+	if once != twice {
+		t.Errorf("Expected normalizePath to be idempotent, got %s then %s", once, twice)
+	}
+	if !strings.EqualFold(once, testExe) {
+		t.Errorf("Expected %s, got %s", testExe, once)
+	}
+}
+
+func TestNormalizePathNestedJunctions(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Junction points are Windows-specific")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-junction-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	// outer -> middle, and middle\inner -> target, so outer\inner\prog.exe
+	// goes through two junctions.
+	targetDir := filepath.Join(tmpDir, "target")
+	middleDir := filepath.Join(tmpDir, "middle")
+	for _, dir := range []string{targetDir, middleDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	testExe := filepath.Join(targetDir, "prog.exe")
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	outerDir := filepath.Join(tmpDir, "outer")
+	for _, link := range [][2]string{{filepath.Join(middleDir, "inner"), targetDir}, {outerDir, middleDir}} {
+		if err := exec.Command("cmd", "/c", "mklink", "/J", link[0], link[1]).Run(); err != nil {
+			t.Fatalf("Failed to create junction: %v", err)
+		}
+	}
+
+	result := normalizePath(filepath.Join(outerDir, "inner", "prog.EXE"))
+	if !strings.EqualFold(result, testExe) {
+		t.Errorf("Expected %s, got %s", testExe, result)
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	targetDir := filepath.Join(tmpDir, "target")
+	middleDir := filepath.Join(tmpDir, "middle")
+	for _, dir := range []string{targetDir, middleDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	if err := os.Symlink(targetDir, filepath.Join(middleDir, "inner")); err != nil {
+		t.Skipf("Cannot create directory symlink: %v", err)
+	}
+	if err := os.Symlink("middle", filepath.Join(tmpDir, "outer")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	t.Run("nested links", func(t *testing.T) {
+		expected := filepath.Join(targetDir, "prog")
+		result, ok := resolveLinks(filepath.Join(tmpDir, "outer", "inner", "prog"))
+		if !ok || result != expected {
+			t.Errorf("Expected %s, got %s (ok %v)", expected, result, ok)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		a := filepath.Join(tmpDir, "a")
+		b := filepath.Join(tmpDir, "b")
+		if err := os.Symlink(b, a); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if err := os.Symlink(a, b); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if _, ok := resolveLinks(filepath.Join(a, "prog")); ok {
+			t.Error("Expected a cycle to be reported")
+		}
+	})
+}
+
+func TestOnDiskCase(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	binDir := filepath.Join(tmpDir, "MyBin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	prog := filepath.Join(binDir, "Prog.exe")
+	if err := os.WriteFile(prog, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Each component is looked up in its corrected parent, so this also
+	// works on case-sensitive filesystems.
+	t.Run("fixes every component", func(t *testing.T) {
+		result := onDiskCase(filepath.Join(tmpDir, "mybin", "PROG.EXE"))
+		if result != prog {
+			t.Errorf("Expected %s, got %s", prog, result)
+		}
+	})
+
+	t.Run("keeps missing components", func(t *testing.T) {
+		expected := filepath.Join(binDir, "missing")
+		result := onDiskCase(filepath.Join(tmpDir, "MYBIN", "missing"))
+		if result != expected {
+			t.Errorf("Expected %s, got %s", expected, result)
+		}
+	})
+
+	t.Run("PATH entry casing differs from disk", func(t *testing.T) {
+		if runtime.GOOS != "windows" {
+			t.Skip("Case-insensitive PATH lookups are Windows-specific")
+		}
+		result := findInDir(filepath.Join(tmpDir, "MYBIN"), "prog", &options{})
+		if result != prog {
+			t.Errorf("Expected %s, got %s", prog, result)
+		}
+	})
+}
+
+func TestCandidatePaths(t *testing.T) {
+	dir := filepath.Join("opt", "bin")
+
+	tests := []struct {
+		name       string
+		input      string
+		extensions []string
+		expected   []string
+	}{
+		{"no extensions", "tool", nil, []string{filepath.Join(dir, "tool")}},
+		{
+			"appends each extension",
+			"tool",
+			[]string{".COM", ".EXE"},
+			[]string{filepath.Join(dir, "tool.COM"), filepath.Join(dir, "tool.EXE")},
+		},
+		{
+			"explicit extension",
+			"tool.exe",
+			[]string{".COM", ".EXE"},
+			[]string{filepath.Join(dir, "tool.exe"), filepath.Join(dir, "tool.exe.COM"), filepath.Join(dir, "tool.exe.EXE")},
+		},
+		{
+			"dotted name without a PATHEXT extension",
+			"app.config",
+			[]string{".COM", ".EXE"},
+			[]string{filepath.Join(dir, "app.config.COM"), filepath.Join(dir, "app.config.EXE")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := candidatePaths(dir, tt.input, tt.extensions)
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("candidatePaths(%q) = %v, expected %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDryPaths(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Candidate order on Windows depends on the current directory and PATHEXT")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	if err := os.Setenv("PATH", "/nonexistent/a:/nonexistent/b"); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	code := run([]string{"--dry-paths", "tool"}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	expected := "/nonexistent/a/tool\n/nonexistent/b/tool\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestDumpCandidates(t *testing.T) {
+	a := filepath.Join(string(filepath.Separator)+"nonexistent", "a")
+	b := filepath.Join(string(filepath.Separator)+"nonexistent", "b")
+	if runtime.GOOS == "windows" {
+		a, b = `C:\nonexistent\a`, `C:\nonexistent\b`
+	}
+
+	args := []string{"--dump-candidates", "--skip-dot", "--path", a + string(os.PathListSeparator) + b, "--pathext", ".COM;.EXE", "tool"}
+	expected := []string{filepath.Join(a, "tool"), filepath.Join(b, "tool")}
+	if runtime.GOOS == "windows" {
+		expected = []string{
+			filepath.Join(a, "tool.COM"), filepath.Join(a, "tool.EXE"),
+			filepath.Join(b, "tool.COM"), filepath.Join(b, "tool.EXE"),
+		}
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run(args, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if result := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n"); !slices.Equal(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	t.Run("caps a huge PATHEXT", func(t *testing.T) {
+		var entries []string
+		for i := 0; i < 100; i++ {
+			entries = append(entries, fmt.Sprintf(".E%d", i))
+		}
+		exts, problems := parseExtensions(strings.Join(entries, ";"))
+		if len(exts) != maxExtensions {
+			t.Errorf("Expected %d extensions, got %d", maxExtensions, len(exts))
+		}
+		if exts[0] != ".E0" {
+			t.Errorf("Expected .E0 as first extension, got %s", exts[0])
+		}
+		if len(problems) != 1 {
+			t.Errorf("Expected one problem about the cap, got %v", problems)
+		}
+	})
+
+	t.Run("removes duplicates case-insensitively", func(t *testing.T) {
+		exts, problems := parseExtensions(".EXE;.exe;.BAT;.EXE")
+		expected := []string{".EXE", ".BAT"}
+		if strings.Join(exts, ";") != strings.Join(expected, ";") {
+			t.Errorf("Expected %v, got %v", expected, exts)
+		}
+		if len(problems) != 0 {
+			t.Errorf("Expected no problems, got %v", problems)
+		}
+	})
+
+	t.Run("drops malformed entries", func(t *testing.T) {
+		exts, problems := parseExtensions(".EXE;BAT;.C\\MD;.")
+		if strings.Join(exts, ";") != ".EXE" {
+			t.Errorf("Expected only .EXE, got %v", exts)
+		}
+		if len(problems) != 3 {
+			t.Errorf("Expected 3 problems, got %v", problems)
+		}
+	})
+}
+
+func TestActualName(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "foo.cmd"), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"exact name", "foo.cmd", "foo.cmd"},
+		{"mismatched extension case", "foo.Cmd", "foo.cmd"},
+		{"mismatched name case", "FOO.CMD", "foo.cmd"},
+		{"missing entry", "bar.cmd", "bar.cmd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := actualName(tmpDir, tt.input)
+			if result != tt.expected {
+				t.Errorf("actualName(%q) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExplicitExtensionCasing(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Extension handling is Windows-specific")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	testCmd := filepath.Join(tmpDir, "foo.cmd")
+	if err := os.WriteFile(testCmd, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	result := findInDir(tmpDir, "foo.Cmd", &options{})
+	if filepath.Base(result) != "foo.cmd" {
+		t.Errorf("Expected on-disk name foo.cmd, got %s", result)
+	}
+}
+
+func TestGNUCompatibility(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir1, err := os.MkdirTemp("", "which-test1")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir1) })
+
+	tmpDir2, err := os.MkdirTemp("", "which-test2")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir2) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir1); err == nil {
+			tmpDir1 = resolved
+		}
+		if resolved, err := filepath.EvalSymlinks(tmpDir2); err == nil {
+			tmpDir2 = resolved
+		}
+	}
+
+	exeName := "prog"
+	if runtime.GOOS == "windows" {
+		exeName = "prog.exe"
+	}
+	testExe1 := filepath.Join(tmpDir1, exeName)
+	testExe2 := filepath.Join(tmpDir2, exeName)
+	for _, exe := range []string{testExe1, testExe2} {
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir1+string(os.PathListSeparator)+tmpDir2); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("-a prints all matches", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"-a", "prog"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		lines := strings.Fields(stdout.String())
+		if len(lines) != 2 || !strings.EqualFold(lines[0], testExe1) || !strings.EqualFold(lines[1], testExe2) {
+			t.Errorf("Expected %s and %s, got %q", testExe1, testExe2, stdout.String())
+		}
+	})
+
+	t.Run("multiple names exit 1 when any is missing", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"prog", "nonexistent"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if !strings.EqualFold(strings.TrimSpace(stdout.String()), testExe1) {
+			t.Errorf("Expected %s, got %q", testExe1, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "nonexistent not found") {
+			t.Errorf("Expected not found message, got %q", stderr.String())
+		}
+	})
+
+	t.Run("-s prints nothing", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"-s", "prog", "nonexistent"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stdout.Len() != 0 || stderr.Len() != 0 {
+			t.Errorf("Expected no output, got stdout %q, stderr %q", stdout.String(), stderr.String())
+		}
+	})
+
+	t.Run("--version prints the version", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--version"}, nil, &stdout, &stderr)
+		if code != 0 || !strings.HasPrefix(stdout.String(), "which ") {
+			t.Errorf("Unexpected version output %q (exit code %d)", stdout.String(), code)
+		}
+	})
+}
+
+func TestSkipDirs(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("No home directory: %v", err)
+	}
+
+	dirs := []string{
+		".",
+		"." + string(filepath.Separator) + "bin",
+		"~" + string(filepath.Separator) + "bin",
+		filepath.Join(home, "bin"),
+		filepath.Join(string(filepath.Separator), "usr", "bin"),
+	}
+
+	t.Run("skip dot", func(t *testing.T) {
+		result := skipDirs(dirs, &options{skipDot: true})
+		if len(result) != 3 || result[0] != dirs[2] {
+			t.Errorf("Unexpected result: %v", result)
+		}
+	})
+
+	t.Run("skip tilde", func(t *testing.T) {
+		result := skipDirs(dirs, &options{skipTilde: true})
+		if len(result) != 3 || result[2] != dirs[4] {
+			t.Errorf("Unexpected result: %v", result)
+		}
+	})
+}
+
+func TestAnyFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no execute permission bit")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	download := filepath.Join(tmpDir, "download")
+	if err := os.WriteFile(download, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	t.Run("--dir alone requires the execute bit", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--dir", tmpDir, "download"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+	})
+
+	t.Run("--any-file reports a non-executable file in --dir", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--dir", tmpDir, "--any-file", "download"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := download + " (not executable)\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("--any-file reports a non-executable explicit path", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--any-file", download}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), "(not executable)") {
+			t.Errorf("Expected not executable label, got %q", stdout.String())
+		}
+	})
+
+	t.Run("--any-file does not apply to PATH lookups", func(t *testing.T) {
+		originalPath := os.Getenv("PATH")
+		t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+		if err := os.Setenv("PATH", tmpDir); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+
+		var stdout, stderr strings.Builder
+		code := run([]string{"--any-file", "download"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+	})
+}
+
+func TestFindExecutableConcurrent(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	var names []string
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("prog%d", i)
+		exe := filepath.Join(tmpDir, name)
+		if runtime.GOOS == "windows" {
+			exe += ".exe"
+		}
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		names = append(names, name)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	opts := &options{all: true}
+	var wg sync.WaitGroup
+	errs := make(chan string, 64)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if findExecutable(name, opts) == "" {
+				errs <- name
+			}
+			if len(findAllExecutables(name, opts)) != 1 {
+				errs <- name
+			}
+		}(names[i%len(names)])
+	}
+	wg.Wait()
+	close(errs)
+
+	for name := range errs {
+		t.Errorf("Concurrent lookup of %s failed", name)
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exeName := "nested"
+	if runtime.GOOS == "windows" {
+		exeName = "nested.exe"
+	}
+	levelOne := filepath.Join(tmpDir, "a")
+	levelTwo := filepath.Join(levelOne, "b")
+	if err := os.MkdirAll(levelTwo, 0755); err != nil {
+		t.Fatalf("Failed to create dirs: %v", err)
+	}
+	shallowExe := filepath.Join(levelOne, exeName)
+	deepExe := filepath.Join(levelTwo, exeName)
+	for _, exe := range []string{shallowExe, deepExe} {
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("default depth does not recurse", func(t *testing.T) {
+		result := findExecutable("nested", &options{})
+		if result != "" {
+			t.Errorf("Expected empty string, got %s", result)
+		}
+	})
+
+	t.Run("depth 1 finds one level down", func(t *testing.T) {
+		result := findAllExecutables("nested", &options{maxDepth: 1})
+		if len(result) != 1 || !strings.EqualFold(result[0], shallowExe) {
+			t.Errorf("Expected only %s, got %v", shallowExe, result)
+		}
+	})
+
+	t.Run("depth 2 finds both levels in order", func(t *testing.T) {
+		result := findAllExecutables("nested", &options{maxDepth: 2})
+		if len(result) != 2 || !strings.EqualFold(result[0], shallowExe) || !strings.EqualFold(result[1], deepExe) {
+			t.Errorf("Expected %s and %s, got %v", shallowExe, deepExe, result)
+		}
+	})
+
+	// Each of these PATHs has a directory that is also walked from
+	// another entry; every file is still reported once.
+	nested := []struct {
+		name string
+		path []string
+	}{
+		{"ancestor first", []string{tmpDir, levelOne}},
+		{"ancestor last", []string{levelTwo, levelOne, tmpDir}},
+	}
+	for _, tt := range nested {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("PATH", strings.Join(tt.path, string(os.PathListSeparator))); err != nil {
+				t.Fatalf("Failed to set PATH: %v", err)
+			}
+			result := findAllExecutables("nested", &options{maxDepth: 2, skipDot: true})
+			if len(result) != 2 {
+				t.Errorf("Expected %s and %s once each, got %v", shallowExe, deepExe, result)
+			}
+		})
+	}
+
+	t.Run("symlinked PATH entry", func(t *testing.T) {
+		link := filepath.Join(t.TempDir(), "link")
+		if err := os.Symlink(levelOne, link); err != nil {
+			t.Skipf("Cannot create symlink: %v", err)
+		}
+		if err := os.Setenv("PATH", link); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		expected := []string{filepath.Join(link, exeName), filepath.Join(link, "b", exeName)}
+		result := findAllExecutables("nested", &options{maxDepth: 1, skipDot: true, noNormalize: true})
+		if len(result) != 2 || !strings.EqualFold(result[0], expected[0]) || !strings.EqualFold(result[1], expected[1]) {
+			t.Errorf("Expected %v, got %v", expected, result)
+		}
+	})
+
+	t.Run("nested entry past the ancestor's depth", func(t *testing.T) {
+		if err := os.Setenv("PATH", tmpDir+string(os.PathListSeparator)+levelOne); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		result := findAllExecutables("nested", &options{maxDepth: 1, skipDot: true})
+		if len(result) != 2 || !strings.EqualFold(result[0], shallowExe) || !strings.EqualFold(result[1], deepExe) {
+			t.Errorf("Expected %s and %s, got %v", shallowExe, deepExe, result)
+		}
+	})
+}
+
+func TestPrintSource(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exeName := "sourced"
+	if runtime.GOOS == "windows" {
+		exeName = "sourced.exe"
+	}
+	emptyDir := filepath.Join(tmpDir, "empty")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{emptyDir, binDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	exe := filepath.Join(binDir, exeName)
+	if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", strings.Join([]string{emptyDir, binDir}, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"PATH entry", []string{"--print-source", "sourced"}, "PATH[1]"},
+		{"explicit path", []string{"--print-source", exe}, "EXPLICIT"},
+		{"dir", []string{"--print-source", "--dir", binDir, "sourced"}, "DIR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run(tt.args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			expected := exe + " (" + tt.expected + ")\n"
+			if !strings.EqualFold(stdout.String(), expected) {
+				t.Errorf("Expected %q, got %q", expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("json source field", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--print-source", "--format", "json", "sourced"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.Contains(stdout.String(), `"source": "PATH[1]"`) {
+			t.Errorf("Expected source PATH[1] in %s", stdout.String())
+		}
+	})
+
+	t.Run("omitted without the flag", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--format", "json", "sourced"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if strings.Contains(stdout.String(), `"source"`) {
+			t.Errorf("Expected no source field, got %s", stdout.String())
+		}
+	})
+}
+
+// TestLookPathConformance compares lookups with exec.LookPath on synthetic
+// PATH setups. The current directory is an empty directory, so the implicit
+// current-directory search on Windows, where which deliberately prefers the
+// current directory the way cmd.exe does while exec.LookPath prefers PATH,
+// does not come into play.
+func TestLookPathConformance(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+
+	cwd := filepath.Join(tmpDir, "cwd")
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{cwd, first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	files := map[string]os.FileMode{
+		filepath.Join(first, "both"+exe):        0755,
+		filepath.Join(second, "both"+exe):       0755,
+		filepath.Join(second, "later"+exe):      0755,
+		filepath.Join(first, "weird.bat"+exe):   0755,
+		filepath.Join(cwd, "local"+exe):         0755,
+		filepath.Join(first, "noexec"+exe):      0644,
+		filepath.Join(second, "noexec"+exe):     0755,
+		filepath.Join(second, "shadowdir"+exe):  0755,
+		filepath.Join(first, "dotted.tool"+exe): 0755,
+	}
+	for path, mode := range files {
+		if err := os.WriteFile(path, []byte("test"), mode); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(first, "shadowdir"+exe), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v", err)
+	}
+	if err := os.Chdir(cwd); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	pathList := strings.Join([]string{first, second}, string(os.PathListSeparator))
+
+	tests := []struct {
+		name string
+		path string
+		file string
+	}{
+		{"first directory wins", pathList, "both"},
+		{"later directory", pathList, "later"},
+		{"not found", pathList, "missing"},
+		{"directory is skipped", pathList, "shadowdir"},
+		{"dotted name", pathList, "dotted.tool"},
+		{"explicit path", pathList, filepath.Join(second, "later")},
+		{"relative explicit path", first, "." + string(filepath.Separator) + "local"},
+		{"parent explicit path", first, filepath.Join("..", "first", "both")},
+		{"empty PATH", "", "both"},
+		{"empty PATH entry", string(os.PathListSeparator) + second, "later"},
+	}
+	if runtime.GOOS == "windows" {
+		tests = append(tests, []struct {
+			name string
+			path string
+			file string
+		}{
+			{"extension appended to a PATHEXT name", pathList, "weird.bat"},
+			{"explicit extension", pathList, "both.exe"},
+		}...)
+	} else {
+		tests = append(tests, struct {
+			name string
+			path string
+			file string
+		}{"non-executable is skipped", pathList, "noexec"})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("PATH", tt.path); err != nil {
+				t.Fatalf("Failed to set PATH: %v", err)
+			}
+			// Relative results come back from exec.LookPath with ErrDot;
+			// which reports them instead of refusing them. exec.LookPath
+			// keeps explicit relative paths relative, as --relative does.
+			expected, err := exec.LookPath(tt.file)
+			if err != nil && !errors.Is(err, exec.ErrDot) {
+				expected = ""
+			}
+			result := findExecutable(tt.file, &options{relative: true})
+			if !strings.EqualFold(filepath.Clean(result), filepath.Clean(expected)) || (result == "") != (expected == "") {
+				t.Errorf("Expected %q like exec.LookPath, got %q", expected, result)
+			}
+			if isPath(tt.file) && result != "" && !isPath(result) {
+				t.Errorf("Expected a path for %q, got bare name %q", tt.file, result)
+			}
+		})
+	}
+}
+
+func TestExtFlag(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows matches extensions through PATHEXT")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	files := map[string]os.FileMode{
+		"build.sh":  0755,
+		"deploy.sh": 0644,
+		"plain":     0644,
+	}
+	for name, mode := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("test"), mode); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     *options
+		expected string
+	}{
+		{"bare name without --ext", "build", &options{}, ""},
+		{"executable script", "build", &options{exts: []string{".sh"}}, "build.sh"},
+		{"non-executable script skipped", "deploy", &options{exts: []string{".sh"}}, ""},
+		{"non-executable script allowed", "deploy", &options{exts: []string{".sh"}, allowNoexecExt: true}, "deploy.sh"},
+		{"bare name still needs exec bit", "plain", &options{exts: []string{".sh"}, allowNoexecExt: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := findExecutable(tt.input, tt.opts)
+			expected := ""
+			if tt.expected != "" {
+				expected = filepath.Join(tmpDir, tt.expected)
+			}
+			if result != expected {
+				t.Errorf("Expected %q, got %q", expected, result)
+			}
+		})
+	}
+
+	t.Run("requires --ext", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--allow-noexec-ext", "deploy"}); err == nil {
+			t.Error("Expected an error for --allow-noexec-ext without --ext")
+		}
+	})
+}
+
+func TestExtEnv(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("WHICH_EXT only applies on Unix")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+	t.Cleanup(func() { _ = os.Unsetenv("WHICH_EXT") })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	for _, name := range []string{"build.sh", "lint.py", "test.rb"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		env      string
+		args     []string
+		expected string
+	}{
+		{"unset", "", []string{"build"}, ""},
+		{"colon separated", ".sh:.py", []string{"lint"}, "lint.py"},
+		{"comma separated", ".py,.sh", []string{"build"}, "build.sh"},
+		{"malformed entry ignored", "rb:.sh", []string{"build"}, "build.sh"},
+		{"--ext overrides", ".sh", []string{"--ext", ".rb", "build"}, ""},
+		{"--ext extension", ".sh", []string{"--ext", ".rb", "test"}, "test.rb"},
+		{"empty --ext turns it off", ".sh", []string{"--ext", "", "build"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.Setenv("WHICH_EXT", tt.env); err != nil {
+				t.Fatalf("Failed to set WHICH_EXT: %v", err)
+			}
+			var stdout, stderr strings.Builder
+			run(tt.args, nil, &stdout, &stderr)
+			expected := ""
+			if tt.expected != "" {
+				expected = filepath.Join(tmpDir, tt.expected) + "\n"
+			}
+			if stdout.String() != expected {
+				t.Errorf("Expected %q, got %q", expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("malformed entry warning", func(t *testing.T) {
+		if err := os.Setenv("WHICH_EXT", "sh"); err != nil {
+			t.Fatalf("Failed to set WHICH_EXT: %v", err)
+		}
+		var stdout, stderr strings.Builder
+		run([]string{"-v", "build"}, nil, &stdout, &stderr)
+		if !strings.Contains(stderr.String(), `WHICH_EXT: ignoring malformed entry "sh"`) {
+			t.Errorf("Expected a warning about WHICH_EXT, got %q", stderr.String())
+		}
+	})
+}
+
+func TestPreferArch(t *testing.T) {
+	sep := string(filepath.Separator)
+	amd := sep + filepath.Join("usr", "lib", "x86_64-linux-gnu", "bin")
+	arm := sep + filepath.Join("usr", "lib", "aarch64-linux-gnu", "bin")
+	plain := sep + filepath.Join("usr", "bin")
+	dirs := []string{plain, arm, amd}
+
+	tests := []struct {
+		arch     string
+		expected []string
+	}{
+		{"x86_64", []string{amd, plain, arm}},
+		{"AARCH64", []string{arm, plain, amd}},
+		{"riscv64", []string{plain, arm, amd}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arch, func(t *testing.T) {
+			result := preferArch(dirs, tt.arch)
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPreferDir(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	early := filepath.Join(tmpDir, "early")
+	late := filepath.Join(tmpDir, "late")
+	for _, dir := range []string{early, late} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "node"+exe), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(early, "npm"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", early+string(os.PathListSeparator)+late); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"preferred directory wins", []string{"--prefer-dir=" + late, "node"}, filepath.Join(late, "node"+exe)},
+		{"falls back to PATH order", []string{"--prefer-dir", late, "npm"}, filepath.Join(early, "npm"+exe)},
+		{"without the flag", []string{"node"}, filepath.Join(early, "node"+exe)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run(tt.args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if !strings.EqualFold(strings.TrimSpace(stdout.String()), tt.expected) {
+				t.Errorf("Expected %s, got %s", tt.expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("-a lists the preferred directory first", func(t *testing.T) {
+		result := preferDir([]string{early, late}, late)
+		if strings.Join(result, "|") != late+"|"+early {
+			t.Errorf("Expected %v, got %v", []string{late, early}, result)
+		}
+	})
+}
+
+func TestReverse(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	var dirs []string
+	for _, name := range []string{"first", "middle", "last"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if name != "middle" {
+			if err := os.WriteFile(filepath.Join(dir, "tool"+exe), []byte("test"), 0755); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	if err := os.Setenv("PATH", strings.Join(dirs, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	first := filepath.Join(dirs[0], "tool"+exe)
+	last := filepath.Join(dirs[2], "tool"+exe)
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"last entry wins", []string{"--reverse", "tool"}, last + "\n"},
+		{"-a is reversed", []string{"--reverse", "-a", "tool"}, last + "\n" + first + "\n"},
+		{"without the flag", []string{"tool"}, first + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run(tt.args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if !strings.EqualFold(stdout.String(), tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+}
+
+func TestResolveDirs(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exeName := "tool"
+	if runtime.GOOS == "windows" {
+		exeName = "tool.exe"
+	}
+	realDir := filepath.Join(tmpDir, "real")
+	if err := os.Mkdir(realDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	exe := filepath.Join(realDir, exeName)
+	if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	linkA := filepath.Join(tmpDir, "link-a")
+	linkB := filepath.Join(tmpDir, "link-b")
+	loopA := filepath.Join(tmpDir, "loop-a")
+	loopB := filepath.Join(tmpDir, "loop-b")
+	for _, link := range [][2]string{{realDir, linkA}, {realDir, linkB}, {loopB, loopA}, {loopA, loopB}} {
+		if err := os.Symlink(link[0], link[1]); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	pathList := strings.Join([]string{loopA, linkA, linkB}, string(os.PathListSeparator))
+	if err := os.Setenv("PATH", pathList); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("symlinked entries searched separately by default", func(t *testing.T) {
+		if result := findAllExecutables("tool", &options{}); len(result) != 2 {
+			t.Errorf("Expected 2 matches, got %v", result)
+		}
+	})
+
+	t.Run("real directory searched once", func(t *testing.T) {
+		result := findAllExecutables("tool", &options{resolveDirs: true})
+		if len(result) != 1 || !strings.EqualFold(result[0], exe) {
+			t.Errorf("Expected only %s, got %v", exe, result)
+		}
+	})
+
+	t.Run("no-symlink-dirs skips symlinked entries", func(t *testing.T) {
+		if result := findAllExecutables("tool", &options{noSymlinkDirs: true}); len(result) != 0 {
+			t.Errorf("Expected no matches, got %v", result)
+		}
+	})
+}
+
+func TestControlCharsInPath(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exeName := "tool"
+	if runtime.GOOS == "windows" {
+		exeName = "tool.exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, exeName), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	corrupt := tmpDir + "\x1b"
+	if err := os.Setenv("PATH", corrupt+string(os.PathListSeparator)+tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	if containsDir(searchDirs(&options{}), corrupt) {
+		t.Errorf("Expected %q to be skipped", corrupt)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"-v", "tool"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "contains control characters") {
+		t.Errorf("Expected a control character warning, got %q", stderr.String())
+	}
+	if !strings.Contains(stderr.String(), `\x1b`) {
+		t.Errorf("Expected the entry to be quoted, got %q", stderr.String())
+	}
+}
+
+func TestPathExtFromRegistry(t *testing.T) {
+	originalPathExt := os.Getenv("PATHEXT")
+	t.Cleanup(func() { _ = os.Setenv("PATHEXT", originalPathExt) })
+
+	if err := os.Setenv("PATHEXT", ""); err != nil {
+		t.Fatalf("Failed to set PATHEXT: %v", err)
+	}
+
+	value, ok := registryPathExt()
+	if runtime.GOOS != "windows" {
+		if ok {
+			t.Errorf("Expected no registry outside Windows, got %q", value)
+		}
+		return
+	}
+	if !ok {
+		t.Skip("PATHEXT is not set in the registry")
+	}
+
+	expected, _ := parseExtensions(value)
+	result := getExtensions(&options{pathextFromRegistry: true})
+	if strings.Join(result, ";") != strings.Join(expected, ";") {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
+
+func TestInode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows reports file indexes instead of inodes")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := filepath.Join(tmpDir, "tool")
+	if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"--inode", "--format", "json", "tool"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	var results []result
+	if err := json.Unmarshal([]byte(stdout.String()), &results); err != nil {
+		t.Fatalf("Failed to parse JSON: %v", err)
+	}
+	if len(results) != 1 || results[0].Inode == 0 {
+		t.Errorf("Expected a non-zero inode, got %s", stdout.String())
+	}
+
+	_, inode, err := fileID(exe)
+	if err != nil || results[0].Inode != inode {
+		t.Errorf("Expected inode %d, got %d (%v)", inode, results[0].Inode, err)
+	}
+}
+
+func TestStdinNames(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	plain := filepath.Join(tmpDir, "tool"+exe)
+	spaced := filepath.Join(tmpDir, "my tool"+exe)
+	for _, path := range []string{plain, spaced} {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("newline-separated names", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--stdin"}, strings.NewReader("tool\r\n\nmy tool\n"), &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := plain + "\n" + spaced + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("dash reads stdin", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"-"}, strings.NewReader("tool\nmy tool\n"), &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := plain + "\n" + spaced + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("dash after -- is a name", func(t *testing.T) {
+		opts, err := parseArgs([]string{"--", "-"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if opts.stdinNames || len(opts.names) != 1 || opts.names[0] != "-" {
+			t.Errorf("Expected the name -, got names %q and stdin %v", opts.names, opts.stdinNames)
+		}
+	})
+
+	t.Run("argument file", func(t *testing.T) {
+		argFile := filepath.Join(tmpDir, "names.txt")
+		if err := os.WriteFile(argFile, []byte("# tools\n  tool  \n\nmy tool\r\n"), 0644); err != nil {
+			t.Fatalf("Failed to create argument file: %v", err)
+		}
+
+		var stdout, stderr strings.Builder
+		if code := run([]string{"@" + argFile}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := plain + "\n" + spaced + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+
+		for _, args := range [][]string{{"--no-argfile", "@" + argFile}, {"--", "@" + argFile}} {
+			stdout.Reset()
+			stderr.Reset()
+			if code := run(args, nil, &stdout, &stderr); code != exitNotFound {
+				t.Errorf("Expected exit code %d for %q, got %d", exitNotFound, args, code)
+			}
+			if expected := "@" + argFile + " not found in PATH\n"; !strings.HasPrefix(stderr.String(), expected) {
+				t.Errorf("Expected a literal lookup for %q, got %q", args, stderr.String())
+			}
+		}
+	})
+
+	t.Run("missing argument file", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"@" + filepath.Join(tmpDir, "missing.txt")}, nil, &stdout, &stderr); code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if !strings.HasPrefix(stderr.String(), "reading names: ") {
+			t.Errorf("Expected a read error, got %q", stderr.String())
+		}
+	})
+
+	t.Run("NUL-separated input and output", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"-0"}, strings.NewReader("tool\x00missing\x00my tool\x00"), &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		expected := plain + "\x00" + spaced + "\x00"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+		if stderr.String() != "missing not found in PATH\n" {
+			t.Errorf("Expected a plain text error, got %q", stderr.String())
+		}
+	})
+
+	t.Run("conflicting format", func(t *testing.T) {
+		if _, err := parseArgs([]string{"-0", "--format", "json"}); err == nil {
+			t.Error("Expected an error for -0 with --format json")
+		}
+	})
+}
+
+func TestPathSet(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	prodDir := filepath.Join(tmpDir, "prod")
+	devDir := filepath.Join(tmpDir, "dev")
+	emptyDir := filepath.Join(tmpDir, "empty")
+	for _, dir := range []string{prodDir, devDir, emptyDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, path := range []string{filepath.Join(prodDir, "go"+exe), filepath.Join(devDir, "go"+exe), filepath.Join(devDir, "dlv"+exe)} {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	devPath := strings.Join([]string{emptyDir, devDir}, string(os.PathListSeparator))
+	var stdout, stderr strings.Builder
+	code := run([]string{"--path-set", "prod=" + prodDir, "--path-set=dev=" + devPath, "go", "dlv"}, nil, &stdout, &stderr)
+	if code != exitNotFound {
+		t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+	}
+
+	expected := "prod: " + filepath.Join(prodDir, "go"+exe) + " (PATH[0])\n" +
+		"dev: " + filepath.Join(devDir, "go"+exe) + " (PATH[1])\n" +
+		"dev: " + filepath.Join(devDir, "dlv"+exe) + " (PATH[1])\n"
+	if !strings.EqualFold(stdout.String(), expected) {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+	if stderr.String() != "dlv not found in prod\n" {
+		t.Errorf("Expected dlv to be missing from prod, got %q", stderr.String())
+	}
+
+	t.Run("requires a name", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--path-set", "/usr/bin", "go"}); err == nil {
+			t.Error("Expected an error for a path set without a name")
+		}
+	})
+}
+
+func TestDottedNameGetsExtension(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("PATHEXT only applies on Windows")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	// app.config itself is not a program, even though it exists.
+	for _, name := range []string{"app.config", "app.config.exe"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	expected := filepath.Join(tmpDir, "app.config.exe")
+	if result := findExecutable("app.config", &options{}); !strings.EqualFold(result, expected) {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+}
+
+func TestOutputFile(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	tool := filepath.Join(binDir, "tool"+exe)
+	if err := os.WriteFile(tool, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	outFile := filepath.Join(tmpDir, "out.txt")
+	readOut := func(t *testing.T) string {
+		t.Helper()
+		data, err := os.ReadFile(outFile)
+		if err != nil {
+			t.Fatalf("Failed to read output file: %v", err)
+		}
+		return string(data)
+	}
+
+	t.Run("truncates", func(t *testing.T) {
+		if err := os.WriteFile(outFile, []byte("stale\n"), 0644); err != nil {
+			t.Fatalf("Failed to create output file: %v", err)
+		}
+		var stdout, stderr strings.Builder
+		if code := run([]string{"-o", outFile, "tool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+		}
+		if got := readOut(t); !strings.EqualFold(got, tool+"\n") {
+			t.Errorf("Expected %q, got %q", tool+"\n", got)
+		}
+	})
+
+	t.Run("appends", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--output-file", outFile, "--append", "tool", "missing"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if got := readOut(t); !strings.EqualFold(got, tool+"\n"+tool+"\n") {
+			t.Errorf("Expected two lines, got %q", got)
+		}
+		if stderr.String() != "missing not found in PATH\n" {
+			t.Errorf("Expected the error on stderr, got %q", stderr.String())
+		}
+	})
+
+	t.Run("unwritable file", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"-o", filepath.Join(tmpDir, "missing", "out.txt"), "tool"}, nil, &stdout, &stderr)
+		if code != exitFailure {
+			t.Errorf("Expected exit code %d, got %d", exitFailure, code)
+		}
+		if stderr.Len() == 0 {
+			t.Error("Expected an error on stderr")
+		}
+	})
+
+	t.Run("--append without --output-file", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--append", "tool"}); err == nil {
+			t.Error("Expected an error for --append without --output-file")
+		}
+	})
+}
+
+func TestBeside(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	tmpDir, _ = filepath.EvalSymlinks(tmpDir)
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	binDir := filepath.Join(tmpDir, "bin")
+	sdkDir := filepath.Join(tmpDir, "sdk", "bin")
+	for _, dir := range []string{binDir, sdkDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, path := range []string{filepath.Join(sdkDir, "tool"+exe), filepath.Join(sdkDir, "helper"+exe), filepath.Join(binDir, "helper"+exe)} {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(sdkDir, "tool"+exe), filepath.Join(binDir, "tool"+exe)); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("searches the anchor's resolved directory", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--beside", "tool", "helper"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := filepath.Join(sdkDir, "helper"+exe) + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("missing anchor", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--beside", "missing", "helper"}, nil, &stdout, &stderr); code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stderr.String() != "--beside: missing not found in PATH\n" {
+			t.Errorf("Expected an anchor error, got %q", stderr.String())
+		}
+	})
+}
+
+func TestFirstOf(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	grep := filepath.Join(tmpDir, "grep"+exe)
+	ag := filepath.Join(tmpDir, "ag"+exe)
+	for _, path := range []string{grep, ag} {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("prints only the first name found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--first-of", "rg", "grep", "ag"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.EqualFold(stdout.String(), grep+"\n") {
+			t.Errorf("Expected %q, got %q", grep+"\n", stdout.String())
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no errors, got %q", stderr.String())
+		}
+	})
+
+	t.Run("none found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--first-of", "rg", "ack"}, nil, &stdout, &stderr); code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("Expected no output, got %q", stdout.String())
+		}
+		if stderr.String() != "none of rg, ack found in PATH\n" {
+			t.Errorf("Expected a single error, got %q", stderr.String())
+		}
+	})
+}
+
+func TestNotFoundExit(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "tool"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected int
+	}{
+		{"soft not found", []string{"--not-found-exit", "0", "missing"}, 0},
+		{"custom status", []string{"--not-found-exit=3", "tool", "missing"}, 3},
+		{"all found", []string{"--not-found-exit", "3", "tool"}, 0},
+		{"first-of", []string{"--not-found-exit", "4", "--first-of", "missing", "other"}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run(tt.args, nil, &stdout, &stderr); code != tt.expected {
+				t.Errorf("Expected exit code %d, got %d", tt.expected, code)
+			}
+			if tt.expected != 0 && stderr.Len() == 0 {
+				t.Error("Expected an error on stderr")
+			}
+		})
+	}
+
+	t.Run("still reports on stderr", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		run([]string{"--not-found-exit", "0", "missing"}, nil, &stdout, &stderr)
+		if stderr.String() != "missing not found in PATH\n" {
+			t.Errorf("Expected the not found message, got %q", stderr.String())
+		}
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--not-found-exit", "256", "tool"}); err == nil {
+			t.Error("Expected an error for an exit status above 255")
+		}
+	})
+}
+
+func TestCwdInPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("The implicit current directory search is Windows-specific")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	prog := filepath.Join(tmpDir, "prog.exe")
+	if err := os.WriteFile(prog, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	for _, path := range []string{tmpDir, strings.ToUpper(tmpDir) + `\`, "."} {
+		t.Run(path, func(t *testing.T) {
+			if err := os.Setenv("PATH", path); err != nil {
+				t.Fatalf("Failed to set PATH: %v", err)
+			}
+			var stdout, stderr strings.Builder
+			if code := run([]string{"-a", "prog"}, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if !strings.EqualFold(stdout.String(), prog+"\n") {
+				t.Errorf("Expected a single result %q, got %q", prog+"\n", stdout.String())
+			}
+		})
+	}
+}
+
+func TestShowPath(t *testing.T) {
+	sep := string(filepath.Separator)
+	a := sep + filepath.Join("opt", "a")
+	b := sep + filepath.Join("opt", "b")
+	list := strings.Join([]string{a, b, a + sep, b}, string(os.PathListSeparator))
+
+	t.Run("drops repeated entries", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--show-path", "--skip-dot", "--path", list}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := a + "\n" + b + "\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("applies --reverse and --prefer-dir", func(t *testing.T) {
+		c := sep + filepath.Join("opt", "c")
+		var stdout, stderr strings.Builder
+		args := []string{"--show-path", "--skip-dot", "--path", list, "--reverse", "--prefer-dir", c}
+		if code := run(args, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := c + "\n" + b + "\n" + a + "\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("current directory first on Windows", func(t *testing.T) {
+		if runtime.GOOS != "windows" {
+			t.Skip("The implicit current directory search is Windows-specific")
+		}
+		cwd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("Failed to get cwd: %v", err)
+		}
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--show-path", "--path", list + ";" + cwd}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := cwd + "\n" + a + "\n" + b + "\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("no program names", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--show-path", "go"}); err == nil {
+			t.Error("Expected an error for --show-path with a program name")
+		}
+	})
+}
+
+func TestExtCaseSensitive(t *testing.T) {
+	t.Run("exact extension", func(t *testing.T) {
+		extensions := []string{".EXE", ".cmd"}
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"tool.EXE", true},
+			{"tool.exe", false},
+			{"tool.cmd", true},
+			{"tool.CMD", false},
+			{"tool", false},
+		}
+		for _, tt := range tests {
+			if result := hasExactExtension(tt.input, extensions); result != tt.expected {
+				t.Errorf("hasExactExtension(%q) = %v, expected %v", tt.input, result, tt.expected)
+			}
+		}
+	})
+
+	t.Run("lookup", func(t *testing.T) {
+		if runtime.GOOS != "windows" {
+			t.Skip("Extensions are always case-sensitive on Unix")
+		}
+
+		tmpDir, err := os.MkdirTemp("", "which-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+
+		lower := filepath.Join(tmpDir, "lower.exe")
+		upper := filepath.Join(tmpDir, "upper.EXE")
+		for _, path := range []string{lower, upper} {
+			if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+
+		pathext := ".EXE"
+		opts := &options{extCaseSensitive: true, pathext: &pathext}
+		if result := findInDir(tmpDir, "upper", opts); result != upper {
+			t.Errorf("Expected %s, got %s", upper, result)
+		}
+		if result := findInDir(tmpDir, "lower", opts); result != "" {
+			t.Errorf("Expected no match for a lowercase extension, got %s", result)
+		}
+		opts.extCaseSensitive = false
+		if result := findInDir(tmpDir, "lower", opts); result != lower {
+			t.Errorf("Expected %s without --ext-case-sensitive, got %s", lower, result)
+		}
+	})
+}
+
+func TestRelativeExplicitPath(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	subdir := filepath.Join(tmpDir, "subdir")
+	if err := os.Mkdir(subdir, 0755); err != nil {
+		t.Fatalf("Failed to create subdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(subdir, "prog"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	name := filepath.Join("subdir", "prog")
+	expected := filepath.Join(subdir, "prog"+exe)
+	if result := findExecutable(name, &options{}); !strings.EqualFold(result, expected) {
+		t.Errorf("Expected %s, got %s", expected, result)
+	}
+
+	expected = filepath.Join("subdir", "prog"+exe)
+	if result := findExecutable(name, &options{relative: true}); !strings.EqualFold(result, expected) {
+		t.Errorf("Expected %s with --relative, got %s", expected, result)
+	}
+}
+
+func TestNoNormalize(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("normalizePath is Windows-specific")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	toolsDir := filepath.Join(tmpDir, "Tools")
+	if err := os.Mkdir(toolsDir, 0755); err != nil {
+		t.Fatalf("Failed to create tools dir: %v", err)
+	}
+	onDisk := filepath.Join(toolsDir, "Prog.exe")
+	if err := os.WriteFile(onDisk, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	// The PATH entry and the query use another casing than the disk.
+	queryDir := filepath.Join(tmpDir, "tools")
+	if err := os.Setenv("PATH", queryDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+	raw := filepath.Join(queryDir, "prog.exe")
+
+	pathext := ".exe"
+	tests := []struct {
+		name string
+		find func(opts *options) string
+	}{
+		{"single match", func(opts *options) string {
+			return findExecutable("prog", opts)
+		}},
+		{"all matches", func(opts *options) string {
+			matches := findMatches("prog", opts, true)
+			if len(matches) != 1 {
+				t.Fatalf("Expected 1 match, got %d", len(matches))
+			}
+			return matches[0].path
+		}},
+		{"explicit path", func(opts *options) string {
+			return findExecutable(filepath.Join(queryDir, "prog"), opts)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.find(&options{pathext: &pathext}); result != onDisk {
+				t.Errorf("Expected %s, got %s", onDisk, result)
+			}
+			if result := tt.find(&options{pathext: &pathext, noNormalize: true}); result != raw {
+				t.Errorf("Expected %s with --no-normalize, got %s", raw, result)
+			}
+		})
+	}
+}
+
+func TestFileSymlinkPathEntry(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	binDir := filepath.Join(tmpDir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create bin dir: %v", err)
+	}
+	testExe := filepath.Join(binDir, "prog"+exe)
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// The PATH entry is a symlink to a file rather than to a directory.
+	fileLink := filepath.Join(tmpDir, "filelink")
+	if err := os.Symlink(testExe, fileLink); err != nil {
+		t.Skipf("Cannot create symlink (requires privilege or developer mode on Windows): %v", err)
+	}
+
+	pathList := strings.Join([]string{fileLink, binDir}, string(os.PathListSeparator))
+	if err := os.Setenv("PATH", pathList); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	if dirs := searchDirs(&options{}); containsDir(dirs, fileLink) {
+		t.Errorf("Expected %s to be skipped, got %v", fileLink, dirs)
+	}
+
+	var stdout, stderr strings.Builder
+	code := run([]string{"--verbose", "-a", "prog"}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	if result := strings.TrimSpace(stdout.String()); !strings.EqualFold(result, testExe) {
+		t.Errorf("Expected %s, got %s", testExe, result)
+	}
+	expected := "warning: PATH entry " + fileLink + " is not a directory, skipping it"
+	if !strings.Contains(stderr.String(), expected) {
+		t.Errorf("Expected %q in stderr, got %q", expected, stderr.String())
+	}
+}
+
+func TestEmitPathExtOrder(t *testing.T) {
+	t.Run("--pathext and --ext", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--emit-pathext-order", "--pathext", ".BAT;.EXE", "--ext", ".py"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+
+		expected := ".py\t--ext\n"
+		if runtime.GOOS == "windows" {
+			expected = ".BAT\t--pathext\n.EXE\t--pathext\n" + expected
+		}
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("sources", func(t *testing.T) {
+		originalPathExt, hadPathExt := os.LookupEnv("PATHEXT")
+		t.Cleanup(func() {
+			if hadPathExt {
+				_ = os.Setenv("PATHEXT", originalPathExt)
+			} else {
+				_ = os.Unsetenv("PATHEXT")
+			}
+		})
+
+		if err := os.Setenv("PATHEXT", ".EXE"); err != nil {
+			t.Fatalf("Failed to set PATHEXT: %v", err)
+		}
+		if source := pathExtSource(&options{}); source != "PATHEXT" {
+			t.Errorf("Expected PATHEXT, got %s", source)
+		}
+
+		empty := ""
+		if source := pathExtSource(&options{pathext: &empty}); source != "default" {
+			t.Errorf("Expected default for an empty --pathext, got %s", source)
+		}
+
+		if err := os.Unsetenv("PATHEXT"); err != nil {
+			t.Fatalf("Failed to unset PATHEXT: %v", err)
+		}
+		if source := pathExtSource(&options{}); source != "default" {
+			t.Errorf("Expected default, got %s", source)
+		}
+	})
+
+	t.Run("takes no names", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--emit-pathext-order", "go"}); err == nil {
+			t.Error("Expected an error for --emit-pathext-order with a program name")
+		}
+	})
+}
+
+func TestConcurrentLookups(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	var dirs []string
+	for _, name := range []string{"first", "second"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		for _, file := range []string{"tool", name + "-only"} {
+			if err := os.WriteFile(filepath.Join(dir, file+exe), []byte("test"), 0755); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	pathList := strings.Join(dirs, string(os.PathListSeparator))
+
+	// Each lookup gets its own options; nothing is shared between them
+	// but the filesystem, so results must match a sequential run.
+	lookups := []struct {
+		name string
+		opts func() *options
+		all  bool
+	}{
+		{"tool", func() *options { return &options{path: &pathList, skipDot: true} }, false},
+		{"tool", func() *options { return &options{path: &pathList, skipDot: true} }, true},
+		{"tool", func() *options { return &options{path: &pathList, skipDot: true, reverse: true} }, false},
+		{"tool", func() *options { return &options{dir: dirs[1]} }, false},
+		{"second-only", func() *options { return &options{path: &pathList, skipDot: true, noNormalize: true} }, true},
+		{"tool", func() *options { return &options{path: &pathList, skipDot: true, preferDir: dirs[1]} }, true},
+		{filepath.Join(dirs[0], "first-only"), func() *options { return &options{relative: true} }, false},
+		{"missing", func() *options { return &options{path: &pathList, skipDot: true} }, true},
+	}
+
+	expected := make([][]match, len(lookups))
+	for i, l := range lookups {
+		expected[i] = findMatches(l.name, l.opts(), l.all)
+	}
+
+	var wg sync.WaitGroup
+	for range 16 {
+		for i, l := range lookups {
+			wg.Go(func() {
+				if result := findMatches(l.name, l.opts(), l.all); !slices.Equal(result, expected[i]) {
+					t.Errorf("Lookup %d of %s: expected %v, got %v", i, l.name, expected[i], result)
+				}
+			})
+		}
+	}
+	wg.Wait()
+}
+
+func TestDotPathEntry(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows searches the current directory first and ignores empty entries")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	prog := filepath.Join(tmpDir, "prog")
+	if err := os.WriteFile(prog, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	sep := string(os.PathListSeparator)
+	for _, path := range []string{".", "/nonexistent" + sep, ".." + sep + "." + sep + sep + tmpDir} {
+		t.Run(path, func(t *testing.T) {
+			if err := os.Setenv("PATH", path); err != nil {
+				t.Fatalf("Failed to set PATH: %v", err)
+			}
+			var stdout, stderr strings.Builder
+			if code := run([]string{"-a", "prog"}, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if stdout.String() != prog+"\n" {
+				t.Errorf("Expected a single result %q, got %q", prog+"\n", stdout.String())
+			}
+		})
+	}
+
+	t.Run("skip dot", func(t *testing.T) {
+		if err := os.Setenv("PATH", "."); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		if result := findExecutable("prog", &options{skipDot: true}); result != "" {
+			t.Errorf("Expected empty string, got %s", result)
+		}
+	})
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+var outputFormats = []string{"plain", "json", "tsv", "path0", "long"}
+
+// result describes the outcome of looking up one name.
+type result struct {
+	Name     string    `json:"name"`
+	Found    bool      `json:"found"`
+	Path     string    `json:"path,omitempty"`
+	Resolved string    `json:"resolved,omitempty"`
+	Applet   string    `json:"applet,omitempty"`
+	Alias    string    `json:"alias,omitempty"`
+	Links    []linkHop `json:"links,omitempty"`
+
+	NotExecutable bool `json:"not_executable,omitempty"`
+
+	// SameAs lists the other matches that are hard links to this one,
+	// with --detect-hardlinks.
+	SameAs []string `json:"same_as,omitempty"`
+
+	// Device and Inode identify the file the match resolves to, with
+	// --inode: st_dev and st_ino on Unix, the volume serial number and
+	// file index on Windows.
+	Device uint64 `json:"device,omitempty"`
+	Inode  uint64 `json:"inode,omitempty"`
+
+	// Shim names the version manager whose shim the match is, with
+	// --unshim.
+	Shim string `json:"shim,omitempty"`
+
+	// Unwrapped is the executable the shim runs, as reported by its
+	// version manager, with --unwrap.
+	Unwrapped string `json:"unwrapped,omitempty"`
+
+	// Checksum is the digest of the match as "algorithm:hex", with
+	// --print-checksum.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Set is the --path-set the match was found in.
+	Set string `json:"set,omitempty"`
+
+	// Source is where the match was found, with --print-source: PATH[i],
+	// CWD, EXPLICIT, DEFAULT or DIR.
+	Source string `json:"source,omitempty"`
+
+	// Reason explains a missing name: not_on_path, not_executable,
+	// is_directory, foreign_path, permission_denied, broken_alternatives,
+	// symlink_loop or script_skipped.
+	Reason string `json:"reason,omitempty"`
+
+	// Why records how the match was found, for --why.
+	Why []string `json:"-"`
+}
+
+var orderKeys = []string{"name", "mtime", "size"}
+
+// foundCount returns how many of results are matches.
+func foundCount(results []result) int {
+	n := 0
+	for _, r := range results {
+		if r.Found {
+			n++
+		}
+	}
+	return n
+}
+
+// sortResults orders results by key: the name, or the modification time or
+// size of the match, ascending. Ties keep their order, and names that were
+// not found go last.
+func sortResults(results []result, key string) {
+	infos := make(map[string]os.FileInfo)
+	for _, r := range results {
+		if r.Found {
+			infos[r.Path], _ = os.Stat(r.Path)
+		}
+	}
+
+	slices.SortStableFunc(results, func(a, b result) int {
+		if a.Found != b.Found {
+			if a.Found {
+				return -1
+			}
+			return 1
+		}
+		ia, ib := infos[a.Path], infos[b.Path]
+		switch {
+		case key == "name" || !a.Found || ia == nil || ib == nil:
+			return strings.Compare(a.Name, b.Name)
+		case key == "mtime":
+			return ia.ModTime().Compare(ib.ModTime())
+		default:
+			return cmp.Compare(ia.Size(), ib.Size())
+		}
+	})
+}
+
+// displayPath is the path printed for a found result.
+func (r result) displayPath() string {
+	if r.Resolved != "" {
+		return r.Resolved
+	}
+	return r.Path
+}
+
+// abbreviate applies --show-dot, --show-tilde and --rel-to to the printed
+// paths of r.
+func abbreviate(r *result, opts *options) {
+	if r.Resolved != "" {
+		r.Resolved = abbreviatePath(r.Resolved, opts)
+	} else if r.Path != "" {
+		r.Path = abbreviatePath(r.Path, opts)
+	}
+	if r.Unwrapped != "" {
+		r.Unwrapped = abbreviatePath(r.Unwrapped, opts)
+	}
+	for i, path := range r.SameAs {
+		r.SameAs[i] = abbreviatePath(path, opts)
+	}
+}
+
+func abbreviatePath(path string, opts *options) string {
+	if opts.relTo != "" {
+		return relativePath(path, opts.relTo)
+	}
+
+	if opts.showDot {
+		if cwd, err := os.Getwd(); err == nil && sameDir(filepath.Dir(path), cwd) {
+			path = "." + string(filepath.Separator) + filepath.Base(path)
+		}
+	}
+
+	// Like GNU which, never abbreviate for root, whose home is rarely
+	// what a reader expects "~" to mean.
+	if opts.showTilde && os.Geteuid() != 0 {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = tildePath(path, home)
+		}
+	}
+	return path
+}
+
+// tildePath rewrites a path under home to start with "~".
+func tildePath(path, home string) string {
+	if home == "" || !filepath.IsAbs(path) || !isWithin(path, home) {
+		return path
+	}
+	rel, err := filepath.Rel(home, path)
+	if err != nil {
+		return path
+	}
+	if rel == "." {
+		return "~"
+	}
+	return "~" + string(filepath.Separator) + rel
+}
+
+// relativePath rewrites path relative to dir, keeping it as is when there is
+// no relative path, such as across drives on Windows.
+func relativePath(path, dir string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return absPath
+	}
+	return rel
+}
+
+// render writes results to w in the output format selected by opts. Every
+// output mode goes through here so the formats stay consistent with each
+// other.
+func render(w io.Writer, results []result, opts *options) error {
+	// --no-newline drops the newline after a lone result. Between several
+	// results it is a separator and is kept.
+	if opts.noNewline && foundCount(results) == 1 {
+		var b strings.Builder
+		single := *opts
+		single.noNewline = false
+		if err := render(&b, results, &single); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, strings.TrimSuffix(b.String(), "\n"))
+		return err
+	}
+
+	switch opts.format {
+	case "json":
+		// No matches is an empty array, not null.
+		if results == nil {
+			results = []result{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	for _, r := range results {
+		if !r.Found {
+			continue
+		}
+
+		var err error
+		switch opts.format {
+		case "tsv":
+			if r.Source != "" {
+				_, err = fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.displayPath(), r.Source)
+			} else {
+				_, err = fmt.Fprintf(w, "%s\t%s\n", r.Name, r.displayPath())
+			}
+		case "path0":
+			_, err = fmt.Fprintf(w, "%s\x00", r.displayPath())
+		case "long":
+			_, err = fmt.Fprintln(w, longLine(r.displayPath()))
+		default:
+			if opts.pathAppend {
+				dir := filepath.Dir(r.displayPath())
+				if abs, aerr := filepath.Abs(dir); aerr == nil {
+					dir = abs
+				}
+				_, err = fmt.Fprintln(w, pathAppendLine(dir, opts.shell))
+			} else if opts.firstDir {
+				_, err = fmt.Fprintln(w, filepath.Dir(r.displayPath()))
+			} else if r.Links != nil {
+				err = writeLinks(w, r.Links)
+			} else if r.Alias != "" {
+				_, err = fmt.Fprintln(w, r.Alias)
+				if err == nil && r.Path != "" {
+					_, err = fmt.Fprintf(w, "\t%s\n", r.displayPath())
+				}
+			} else if r.Applet != "" {
+				// abbreviate only shortens Resolved, the path printed
+				// elsewhere, so the link is shortened here.
+				path, target := abbreviatePath(r.Path, opts), r.Resolved
+				if opts.shellQuote {
+					path, target = shellQuote(path, runtime.GOOS), shellQuote(target, runtime.GOOS)
+				}
+				_, err = fmt.Fprintf(w, "%s -> %s (applet: %s)\n", path, target, r.Applet)
+			} else if r.NotExecutable {
+				_, err = fmt.Fprintf(w, "%s (not executable)\n", r.displayPath())
+			} else {
+				path := r.displayPath()
+				if opts.shellQuote {
+					path = shellQuote(path, runtime.GOOS)
+				}
+				if r.Set != "" {
+					path = r.Set + ": " + path
+				}
+				if r.Inode != 0 {
+					path += fmt.Sprintf(" (device %d, inode %d)", r.Device, r.Inode)
+				}
+				if len(r.SameAs) > 0 {
+					path += " (same file as " + strings.Join(r.SameAs, ", ") + ")"
+				}
+				if r.Unwrapped != "" {
+					path += " (" + r.Shim + " shim -> " + r.Unwrapped + ")"
+				} else if r.Shim != "" {
+					path += " (" + r.Shim + " shim)"
+				}
+				if r.Source != "" {
+					path += " (" + r.Source + ")"
+				}
+				if r.Checksum != "" {
+					path += " (" + r.Checksum + ")"
+				}
+				_, err = fmt.Fprintln(w, path)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// longLine formats path in the style of ls -l: mode, size, modification
+// time and path.
+func longLine(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return path
+	}
+	return fmt.Sprintf("%s %10d %s %s", info.Mode(), info.Size(), info.ModTime().Format("2006-01-02 15:04"), path)
+}
+
+// writeLinks prints a --trace-links chain: the match, then one indented line
+// per hop, each with its status.
+func writeLinks(w io.Writer, hops []linkHop) error {
+	for i, hop := range hops {
+		prefix := ""
+		if i > 0 {
+			prefix = "  -> "
+		}
+		status := hop.Status
+		if status == "missing" {
+			status += " (dangling link)"
+		}
+		if _, err := fmt.Fprintf(w, "%s%s: %s\n", prefix, hop.Path, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pathAppendShells lists the shells --path-append writes for. bash and zsh
+// get the sh syntax, pwsh that of powershell.
+var pathAppendShells = []string{"sh", "bash", "zsh", "fish", "powershell", "pwsh", "cmd"}
+
+// defaultShell is the --shell used when none is given: cmd on Windows, to
+// match --shell-quote, and sh elsewhere.
+func defaultShell() string {
+	if runtime.GOOS == "windows" {
+		return "cmd"
+	}
+	return "sh"
+}
+
+// pathAppendLine returns the --path-append command that appends dir to
+// PATH in shell, e.g. export PATH="$PATH:/usr/local/go/bin" for sh. The
+// cmd line is meant for a batch file, where a literal % is written %%.
+func pathAppendLine(dir, shell string) string {
+	switch shell {
+	case "fish":
+		return "set -gx PATH $PATH '" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(dir) + "'"
+	case "powershell", "pwsh":
+		return "$env:PATH += [IO.Path]::PathSeparator + '" + strings.ReplaceAll(dir, "'", "''") + "'"
+	case "cmd":
+		return `set "PATH=%PATH%;` + strings.ReplaceAll(dir, "%", "%%") + `"`
+	default:
+		return `export PATH="$PATH:` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(dir) + `"`
+	}
+}
+
+// shellQuote quotes path for the shell of goos: POSIX single quotes, or cmd
+// double quotes on Windows. Windows paths cannot contain double quotes, but
+// cmd still expands % and ! inside them, so those are caret-escaped outside
+// the quotes.
+func shellQuote(path, goos string) string {
+	if goos == "windows" {
+		var b strings.Builder
+		b.WriteByte('"')
+		for _, c := range path {
+			if c == '%' || c == '!' {
+				b.WriteString(`"^`)
+				b.WriteRune(c)
+				b.WriteByte('"')
+				continue
+			}
+			b.WriteRune(c)
+		}
+		b.WriteByte('"')
+		return b.String()
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
@@ -0,0 +1,729 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	results := []result{
+		{Name: "go", Found: true, Path: "/usr/local/go/bin/go"},
+		{Name: "missing"},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"plain", "/usr/local/go/bin/go\n"},
+		{"tsv", "go\t/usr/local/go/bin/go\n"},
+		{"path0", "/usr/local/go/bin/go\x00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out strings.Builder
+			if err := render(&out, results, &options{format: tt.format}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, out.String())
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var out strings.Builder
+		if err := render(&out, results, &options{format: "json"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var decoded []result
+		if err := json.Unmarshal([]byte(out.String()), &decoded); err != nil {
+			t.Fatalf("Invalid JSON %q: %v", out.String(), err)
+		}
+		if len(decoded) != 2 || !decoded[0].Found || decoded[1].Found {
+			t.Errorf("Unexpected JSON results: %+v", decoded)
+		}
+		if strings.Contains(out.String(), `"path": ""`) {
+			t.Errorf("Expected empty path to be omitted, got %s", out.String())
+		}
+	})
+
+	t.Run("long", func(t *testing.T) {
+		tmpDir, err := os.MkdirTemp("", "which-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+		testExe := filepath.Join(tmpDir, "prog")
+		if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+
+		var out strings.Builder
+		if err := render(&out, []result{{Name: "prog", Found: true, Path: testExe}}, &options{format: "long"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		fields := strings.Fields(out.String())
+		if len(fields) != 5 || fields[1] != "4" || fields[4] != testExe {
+			t.Errorf("Unexpected long line: %q", out.String())
+		}
+	})
+}
+
+func TestFormatFlag(t *testing.T) {
+	if _, err := parseArgs([]string{"--format", "yaml", "go"}); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+
+	opts, err := parseArgs([]string{"go"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if opts.format != "plain" {
+		t.Errorf("Expected plain as the default format, got %s", opts.format)
+	}
+}
+
+func TestShowDot(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exeName := "dotprog"
+	if runtime.GOOS == "windows" {
+		exeName = "dotprog.exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, exeName), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	code := run([]string{"--show-dot", "dotprog"}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	expected := "." + string(filepath.Separator) + exeName
+	if !strings.EqualFold(strings.TrimSpace(stdout.String()), expected) {
+		t.Errorf("Expected %s, got %q", expected, stdout.String())
+	}
+}
+
+func TestRelTo(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exeName := "tool"
+	if runtime.GOOS == "windows" {
+		exeName = "tool.exe"
+	}
+	binDir := filepath.Join(tmpDir, "build", "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(binDir, exeName), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	origDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get cwd: %v", err)
+	}
+	if err := os.Chdir(tmpDir); err != nil {
+		t.Fatalf("Failed to chdir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"PATH match relative to cwd", []string{"--rel-to", ".", "tool"}, filepath.Join("build", "bin", exeName)},
+		{"explicit path", []string{"--rel-to", ".", "./build/bin/tool"}, filepath.Join("build", "bin", exeName)},
+		{"relative to another directory", []string{"--rel-to", filepath.Join(tmpDir, "other"), "tool"}, filepath.Join("..", "build", "bin", exeName)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run(tt.args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if !strings.EqualFold(strings.TrimSpace(stdout.String()), tt.expected) {
+				t.Errorf("Expected %s, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("conflicts with --show-dot", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--rel-to", ".", "--show-dot", "tool"}); err == nil {
+			t.Error("Expected an error for --rel-to with --show-dot")
+		}
+	})
+}
+
+func TestTildePath(t *testing.T) {
+	home := filepath.Join(string(filepath.Separator), "home", "user")
+	sep := string(filepath.Separator)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"under home", filepath.Join(home, "bin", "tool"), "~" + sep + "bin" + sep + "tool"},
+		{"outside home", filepath.Join(string(filepath.Separator), "usr", "bin", "tool"), filepath.Join(string(filepath.Separator), "usr", "bin", "tool")},
+		{"sibling with home as prefix", filepath.Join(string(filepath.Separator), "home", "username", "tool"), filepath.Join(string(filepath.Separator), "home", "username", "tool")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runtime.GOOS == "windows" {
+				t.Skip("Paths without a volume are not absolute on Windows")
+			}
+			result := tildePath(tt.path, home)
+			if result != tt.expected {
+				t.Errorf("tildePath(%q) = %q, expected %q", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestShowTilde(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("--show-tilde is ignored for root")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	homeVar := "HOME"
+	if runtime.GOOS == "windows" {
+		homeVar = "USERPROFILE"
+	}
+	originalHome := os.Getenv(homeVar)
+	t.Cleanup(func() { _ = os.Setenv(homeVar, originalHome) })
+
+	home, err := os.MkdirTemp("", "which-home")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(home) })
+
+	if resolved, err := filepath.EvalSymlinks(home); err == nil {
+		home = resolved
+	}
+
+	binDir := filepath.Join(home, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		t.Fatalf("Failed to create bin dir: %v", err)
+	}
+
+	exeName := "hometool"
+	if runtime.GOOS == "windows" {
+		exeName = "hometool.exe"
+	}
+	if err := os.WriteFile(filepath.Join(binDir, exeName), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv(homeVar, home); err != nil {
+		t.Fatalf("Failed to set %s: %v", homeVar, err)
+	}
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("abbreviates a home-relative match", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--show-tilde", "hometool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := filepath.Join("~", "bin", exeName)
+		if !strings.EqualFold(strings.TrimSpace(stdout.String()), expected) {
+			t.Errorf("Expected %s, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("leaves a non-home match alone", func(t *testing.T) {
+		otherDir, err := os.MkdirTemp("", "which-test")
+		if err != nil {
+			t.Fatalf("Failed to create temp dir: %v", err)
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(otherDir) })
+
+		if resolved, err := filepath.EvalSymlinks(otherDir); err == nil {
+			otherDir = resolved
+		}
+
+		otherExe := filepath.Join(otherDir, exeName)
+		if err := os.WriteFile(otherExe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.Setenv("PATH", otherDir); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+
+		var stdout, stderr strings.Builder
+		code := run([]string{"--show-tilde", "hometool"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.EqualFold(strings.TrimSpace(stdout.String()), otherExe) {
+			t.Errorf("Expected %s, got %q", otherExe, stdout.String())
+		}
+	})
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		goos     string
+		expected string
+	}{
+		{"posix plain", "/usr/bin/go", "linux", "'/usr/bin/go'"},
+		{"posix spaces", "/opt/my tool/bin/tool", "linux", "'/opt/my tool/bin/tool'"},
+		{"posix single quote", "/opt/it's/tool", "darwin", `'/opt/it'\''s/tool'`},
+		{"cmd spaces", `C:\Program Files\Tool\tool.exe`, "windows", `"C:\Program Files\Tool\tool.exe"`},
+		{"cmd percent", `C:\100%\tool.exe`, "windows", `"C:\100"^%"\tool.exe"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := shellQuote(tt.path, tt.goos)
+			if result != tt.expected {
+				t.Errorf("shellQuote(%q) = %s, expected %s", tt.path, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	// Each file has a different rank for name, mtime and size.
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"beta", 30, 2 * time.Hour},
+		{"alpha", 20, 1 * time.Hour},
+		{"gamma", 10, 3 * time.Hour},
+	}
+	var results []result
+	for _, f := range files {
+		path := filepath.Join(tmpDir, f.name)
+		if err := os.WriteFile(path, make([]byte, f.size), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		mtime := time.Now().Add(-f.age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+		results = append(results, result{Name: f.name, Found: true, Path: path})
+	}
+	results = append([]result{{Name: "aardvark"}}, results...)
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"name", "alpha beta gamma aardvark"},
+		{"mtime", "gamma beta alpha aardvark"},
+		{"size", "gamma alpha beta aardvark"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			sorted := slices.Clone(results)
+			sortResults(sorted, tt.key)
+			var names []string
+			for _, r := range sorted {
+				names = append(names, r.Name)
+			}
+			if result := strings.Join(names, " "); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	t.Run("unknown key", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--order", "age", "go"}); err == nil {
+			t.Error("Expected an error for an unknown order")
+		}
+	})
+}
+
+func TestFirstDir(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exeName := "node"
+	if runtime.GOOS == "windows" {
+		exeName = "node.exe"
+	}
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, exeName), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", strings.Join([]string{first, second}, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("prints the first directory only", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--first-dir", "-a", "node"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.EqualFold(stdout.String(), first+"\n") {
+			t.Errorf("Expected %s, got %q", first, stdout.String())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--first-dir", "missing"}, nil, &stdout, &stderr); code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stdout.String() != "" {
+			t.Errorf("Expected no output, got %q", stdout.String())
+		}
+	})
+}
+
+func TestPrintChecksum(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	testExe := filepath.Join(tmpDir, "tool"+exe)
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	// Digests of "test".
+	sums := map[string]string{
+		"sha256": "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"sha1":   "sha1:a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+		"md5":    "md5:098f6bcd4621d373cade4e832627b4f6",
+	}
+	for algorithm, sum := range sums {
+		t.Run(algorithm, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if code := run([]string{"--print-checksum", algorithm, "tool"}, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			expected := testExe + " (" + sum + ")\n"
+			if !strings.EqualFold(stdout.String(), expected) {
+				t.Errorf("Expected %q, got %q", expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--print-checksum", "sha256", "--format", "json", "tool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		var results []result
+		if err := json.Unmarshal([]byte(stdout.String()), &results); err != nil {
+			t.Fatalf("Failed to parse JSON: %v", err)
+		}
+		if len(results) != 1 || results[0].Checksum != sums["sha256"] {
+			t.Errorf("Expected checksum %s, got %+v", sums["sha256"], results)
+		}
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--print-checksum", "crc32", "tool"}); err == nil {
+			t.Error("Expected an error for an unknown checksum algorithm")
+		}
+	})
+}
+
+func TestNoNewline(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	var paths []string
+	for _, name := range []string{"tool", "other"} {
+		path := filepath.Join(tmpDir, name+exe)
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("single result", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--no-newline", "--skip-dot", "tool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.EqualFold(stdout.String(), paths[0]) {
+			t.Errorf("Expected %q, got %q", paths[0], stdout.String())
+		}
+	})
+
+	t.Run("several results keep their newlines", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--no-newline", "--skip-dot", "tool", "other"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := paths[0] + "\n" + paths[1] + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--no-newline", "--format", "json", "tool"}); err == nil {
+			t.Error("Expected an error for --no-newline with --format json")
+		}
+	})
+}
+
+func TestPathAppend(t *testing.T) {
+	tests := []struct {
+		shell    string
+		dir      string
+		expected string
+	}{
+		{"sh", "/usr/local/go/bin", `export PATH="$PATH:/usr/local/go/bin"`},
+		{"bash", `/opt/$HOME "x"`, `export PATH="$PATH:/opt/\$HOME \"x\""`},
+		{"fish", "/opt/it's", `set -gx PATH $PATH '/opt/it\'s'`},
+		{"powershell", `C:\Tools\it's`, `$env:PATH += [IO.Path]::PathSeparator + 'C:\Tools\it''s'`},
+		{"cmd", `C:\Go\bin`, `set "PATH=%PATH%;C:\Go\bin"`},
+		{"cmd", `C:\100%\bin`, `set "PATH=%PATH%;C:\100%%\bin"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			if result := pathAppendLine(tt.dir, tt.shell); result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "tool"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--path-append", "--shell", "pwsh", "tool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := pathAppendLine(tmpDir, "pwsh") + "\n"
+		if !strings.EqualFold(stdout.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("not abbreviated", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("The home directory comes from USERPROFILE on Windows")
+		}
+		t.Setenv("HOME", tmpDir)
+		for _, flags := range [][]string{{"--show-tilde"}, {"--rel-to", filepath.Dir(tmpDir)}} {
+			var stdout, stderr strings.Builder
+			args := append([]string{"--path-append"}, append(flags, "tool")...)
+			if code := run(args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if expected := pathAppendLine(tmpDir, "sh") + "\n"; stdout.String() != expected {
+				t.Errorf("Expected %q with %v, got %q", expected, flags, stdout.String())
+			}
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--path-append", "which-test-missing"}, nil, &stdout, &stderr); code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("Expected no output, got %q", stdout.String())
+		}
+	})
+
+	t.Run("--shell requires --path-append", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--shell", "fish", "tool"}); err == nil {
+			t.Error("Expected an error for --shell without --path-append")
+		}
+	})
+
+	t.Run("unknown shell", func(t *testing.T) {
+		if _, err := parseArgs([]string{"--path-append", "--shell", "tcsh", "tool"}); err == nil {
+			t.Error("Expected an error for an unknown shell")
+		}
+	})
+}
+
+func TestJSONNoMatches(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "tool"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"first-of", []string{"--first-of", "nope1", "nope2"}},
+		{"any-of", []string{"--any-of", "zzz*"}},
+		{"assert", []string{"--assert", filepath.Join(tmpDir, "other"+exe), "tool"}},
+		{"require-dir", []string{"--require-dir", filepath.Join(tmpDir, "sub"), "tool"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			args := append([]string{"--format", "json", "--skip-dot"}, tt.args...)
+			if code := run(args, nil, &stdout, &stderr); code == 0 {
+				t.Fatalf("Expected a non-zero exit code, got 0")
+			}
+			if stdout.String() != "[]\n" {
+				t.Errorf("Expected an empty JSON array, got %q", stdout.String())
+			}
+		})
+	}
+}
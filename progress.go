@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// progress is the --progress indicator: a stderr line, rewritten in place,
+// with how many search directories a scan has gone through. It is only
+// shown when stderr is a terminal, so it never ends up in a log or pipe.
+type progress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	shown bool
+}
+
+// newProgress returns the indicator for --progress, or nil when stderr is
+// not a terminal.
+func newProgress(stderr io.Writer) *progress {
+	f, ok := stderr.(*os.File)
+	if !ok || !isTerminal(f) {
+		return nil
+	}
+	return &progress{w: stderr}
+}
+
+// update shows that done of total directories have been scanned.
+func (p *progress) update(done, total int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, _ = fmt.Fprintf(p.w, "\rscanned %d/%d directories", done, total)
+	p.shown = true
+}
+
+// clear erases the indicator, so that the next message starts on a clean
+// line.
+func (p *progress) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.shown {
+		_, _ = fmt.Fprint(p.w, "\r\033[K")
+		p.shown = false
+	}
+}
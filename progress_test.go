@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	var dirs []string
+	for _, name := range []string{"a", "b", "c"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		dirs = append(dirs, dir)
+	}
+	if err := os.WriteFile(filepath.Join(dirs[2], "tool"+exe), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", strings.Join(dirs, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("terminal", func(t *testing.T) {
+		var stderr strings.Builder
+		opts := &options{skipDot: true, progress: &progress{w: &stderr}}
+		if result := findExecutable("tool", opts); result == "" {
+			t.Fatal("Expected tool to be found")
+		}
+		expected := "\rscanned 1/3 directories\rscanned 2/3 directories\rscanned 3/3 directories\r\033[K"
+		if stderr.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+
+	t.Run("not a terminal", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--progress", "--skip-dot", "tool"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no progress output, got %q", stderr.String())
+		}
+		if strings.Contains(stdout.String(), "scanned") {
+			t.Errorf("Expected progress to stay off stdout, got %q", stdout.String())
+		}
+	})
+}
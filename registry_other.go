@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// registryPathExt reports that there is no registry to read PATHEXT from.
+func registryPathExt() (string, bool) {
+	return "", false
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// registryEnvironments are the registry keys Windows builds the environment
+// of new processes from, user first since its values take precedence.
+var registryEnvironments = []struct {
+	root syscall.Handle
+	path string
+}{
+	{syscall.HKEY_CURRENT_USER, `Environment`},
+	{syscall.HKEY_LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Control\Session Manager\Environment`},
+}
+
+// registryPathExt reads PATHEXT from the user or system environment in the
+// registry.
+func registryPathExt() (string, bool) {
+	for _, env := range registryEnvironments {
+		if value, ok := registryString(env.root, env.path, "PATHEXT"); ok && value != "" {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// registryString reads a REG_SZ or REG_EXPAND_SZ value. Expandable values are
+// returned unexpanded.
+func registryString(root syscall.Handle, path, name string) (string, bool) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", false
+	}
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return "", false
+	}
+
+	var key syscall.Handle
+	if err := syscall.RegOpenKeyEx(root, pathPtr, 0, syscall.KEY_READ, &key); err != nil {
+		return "", false
+	}
+	defer func() { _ = syscall.RegCloseKey(key) }()
+
+	var valueType, size uint32
+	if err := syscall.RegQueryValueEx(key, namePtr, nil, &valueType, nil, &size); err != nil || size == 0 {
+		return "", false
+	}
+	if valueType != syscall.REG_SZ && valueType != syscall.REG_EXPAND_SZ {
+		return "", false
+	}
+
+	buf := make([]uint16, size/2+1)
+	if err := syscall.RegQueryValueEx(key, namePtr, nil, &valueType, (*byte)(unsafe.Pointer(&buf[0])), &size); err != nil {
+		return "", false
+	}
+	return syscall.UTF16ToString(buf), true
+}
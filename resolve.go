@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// defaultMulticallBinaries lists binaries that pick their behavior from the
+// name they were invoked as.
+var defaultMulticallBinaries = []string{"busybox", "toybox"}
+
+// resolveResult follows the symlinks of a found executable and records the
+// target, plus the applet name under --applet, on r.
+func resolveResult(r *result, opts *options) {
+	target, err := filepath.EvalSymlinks(r.Path)
+	if err != nil {
+		opts.warnf("cannot resolve %s: %v", r.Path, err)
+		return
+	}
+	r.Resolved = target
+
+	if opts.verbose && target != r.Path && !inSearchDirs(filepath.Dir(target), opts) {
+		opts.warnf("%s resolves to %s, which is not in PATH", r.Path, target)
+	}
+
+	if opts.applet {
+		multicall := opts.multicall
+		if multicall == nil {
+			multicall = defaultMulticallBinaries
+		}
+		if applet, ok := appletName(r.Path, target, multicall, getExtensions(opts)); ok {
+			r.Applet = applet
+		}
+	}
+}
+
+// inSearchDirs reports whether dir is one of the search directories, or the
+// real directory one of them is a symlink to.
+func inSearchDirs(dir string, opts *options) bool {
+	for _, d := range searchDirs(opts) {
+		if sameDir(d, dir) {
+			return true
+		}
+		if realDir, err := filepath.EvalSymlinks(d); err == nil && sameDir(realDir, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// appletName reports the applet a multi-call binary runs when it is reached
+// through path, provided target is one of the multicall binaries and path
+// does not simply name the binary itself.
+func appletName(path, target string, multicall, extensions []string) (string, bool) {
+	applet := commandName(path, extensions)
+	binary := commandName(target, extensions)
+
+	if applet == binary {
+		return "", false
+	}
+	for _, name := range multicall {
+		if sameName(binary, name) {
+			return applet, true
+		}
+	}
+	return "", false
+}
+
+// commandName returns the name a file is invoked as, without any of the
+// PATHEXT extensions.
+func commandName(path string, extensions []string) string {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	for _, e := range extensions {
+		if strings.EqualFold(ext, e) {
+			return strings.TrimSuffix(base, ext)
+		}
+	}
+	return base
+}
+
+func sameName(a, b string) bool {
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// maxLinkHops bounds how many symlinks traceLinks follows, like the kernel's
+// own limit, so a cycle cannot loop forever.
+const maxLinkHops = 40
+
+// linkHop is one step of a symlink chain.
+type linkHop struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // "symlink", "file", "missing" or "loop"
+}
+
+// traceLinks follows the symlink chain starting at path one hop at a time,
+// using Readlink rather than EvalSymlinks so every intermediate link is
+// checked. It stops at the first hop that does not exist.
+func traceLinks(path string) []linkHop {
+	var hops []linkHop
+	for range maxLinkHops {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return append(hops, linkHop{Path: path, Status: "missing"})
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return append(hops, linkHop{Path: path, Status: "file"})
+		}
+		hops = append(hops, linkHop{Path: path, Status: "symlink"})
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return append(hops, linkHop{Path: path, Status: "missing"})
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return append(hops, linkHop{Path: path, Status: "loop"})
+}
+
+// markHardlinks sets SameAs on each found result whose file is also reached
+// through another, differently named path among results. Symlinks are
+// compared as links, not by their targets, so only hard links are grouped.
+func markHardlinks(results []result) {
+	infos := make([]os.FileInfo, len(results))
+	for i, r := range results {
+		if r.Found {
+			infos[i], _ = os.Lstat(r.Path)
+		}
+	}
+
+	for i := range results {
+		for j := range results {
+			if i == j || infos[i] == nil || infos[j] == nil || results[i].Path == results[j].Path {
+				continue
+			}
+			if os.SameFile(infos[i], infos[j]) && !slices.Contains(results[i].SameAs, results[j].Path) {
+				results[i].SameAs = append(results[i].SameAs, results[j].Path)
+			}
+		}
+	}
+}
+
+// uniqueFiles drops each found result whose file, with symlinks followed,
+// is the same as that of an earlier result, and lists its path in SameAs of
+// the result kept instead.
+func uniqueFiles(results []result) []result {
+	var kept []result
+	var infos []os.FileInfo
+	for _, r := range results {
+		var info os.FileInfo
+		if r.Found {
+			info, _ = os.Stat(r.Path)
+		}
+		if info != nil {
+			i := slices.IndexFunc(infos, func(other os.FileInfo) bool {
+				return other != nil && os.SameFile(info, other)
+			})
+			if i >= 0 {
+				if r.Path != kept[i].Path && !slices.Contains(kept[i].SameAs, r.Path) {
+					kept[i].SameAs = append(kept[i].SameAs, r.Path)
+				}
+				continue
+			}
+		}
+		kept = append(kept, r)
+		infos = append(infos, info)
+	}
+	return kept
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestAppletName(t *testing.T) {
+	multicall := []string{"busybox", "toybox"}
+
+	tests := []struct {
+		name     string
+		path     string
+		target   string
+		applet   string
+		expected bool
+	}{
+		{"busybox applet", "/bin/ls", "/bin/busybox", "ls", true},
+		{"toybox applet", "/usr/bin/cat", "/usr/bin/toybox", "cat", true},
+		{"busybox itself", "/bin/busybox", "/bin/busybox", "", false},
+		{"ordinary symlink", "/usr/bin/python3", "/usr/bin/python3.12", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applet, ok := appletName(tt.path, tt.target, multicall, getExtensions(&options{}))
+			if ok != tt.expected || applet != tt.applet {
+				t.Errorf("appletName(%q, %q) = %q, %v, expected %q, %v",
+					tt.path, tt.target, applet, ok, tt.applet, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveApplet(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Symlinks require elevated privileges on Windows")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	busybox := filepath.Join(tmpDir, "busybox")
+	if err := os.WriteFile(busybox, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	ls := filepath.Join(tmpDir, "ls")
+	if err := os.Symlink(busybox, ls); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	t.Run("records the resolved target", func(t *testing.T) {
+		r := result{Name: "ls", Found: true, Path: ls}
+		resolveResult(&r, &options{resolve: true})
+		if r.Resolved != busybox {
+			t.Errorf("Expected %s, got %s", busybox, r.Resolved)
+		}
+		if r.Applet != "" {
+			t.Errorf("Expected no applet without --applet, got %s", r.Applet)
+		}
+	})
+
+	t.Run("annotates a multi-call applet", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if err := os.Setenv("PATH", tmpDir); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		code := run([]string{"--resolve", "--applet", "ls"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := ls + " -> " + busybox + " (applet: ls)\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("abbreviates and quotes the applet line", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if err := os.Setenv("PATH", tmpDir); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+		code := run([]string{"--resolve", "--applet", "--rel-to", tmpDir, "--shell-quote", "ls"}, nil, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := "'ls' -> 'busybox' (applet: ls)\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("honors a custom multi-call list", func(t *testing.T) {
+		r := result{Name: "ls", Found: true, Path: ls}
+		resolveResult(&r, &options{resolve: true, applet: true, multicall: []string{"toybox"}})
+		if r.Applet != "" {
+			t.Errorf("Expected no applet, got %s", r.Applet)
+		}
+	})
+}
+
+func TestResolveOutsidePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Symlinks require elevated privileges on Windows")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	binDir := filepath.Join(tmpDir, "bin")
+	vendorDir := filepath.Join(tmpDir, "vendor")
+	for _, dir := range []string{binDir, vendorDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, path := range []string{filepath.Join(vendorDir, "foo"), filepath.Join(binDir, "real")} {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	foo := filepath.Join(binDir, "foo")
+	if err := os.Symlink(filepath.Join(vendorDir, "foo"), foo); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("real", filepath.Join(binDir, "alias")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Setenv("PATH", binDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("warns about a target outside PATH", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--resolve", "--verbose", "foo"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		target := filepath.Join(vendorDir, "foo")
+		if stdout.String() != target+"\n" {
+			t.Errorf("Expected %q, got %q", target+"\n", stdout.String())
+		}
+		expected := "warning: " + foo + " resolves to " + target + ", which is not in PATH\n"
+		if stderr.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+
+	t.Run("quiet for a target in PATH", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--resolve", "--verbose", "alias"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no warning, got %q", stderr.String())
+		}
+	})
+
+	t.Run("quiet without --verbose", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		run([]string{"--resolve", "foo"}, nil, &stdout, &stderr)
+		if stderr.Len() != 0 {
+			t.Errorf("Expected no warning, got %q", stderr.String())
+		}
+	})
+}
+
+func TestTraceLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Symlinks require elevated privileges on Windows")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	target := filepath.Join(tmpDir, "target")
+	if err := os.WriteFile(target, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Symlink("target", filepath.Join(tmpDir, "middle")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(tmpDir, "middle"), filepath.Join(tmpDir, "prog")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("missing", filepath.Join(tmpDir, "broken-middle")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink("broken-middle", filepath.Join(tmpDir, "broken")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	t.Run("follows a healthy chain", func(t *testing.T) {
+		hops := traceLinks(filepath.Join(tmpDir, "prog"))
+		expected := []linkHop{
+			{filepath.Join(tmpDir, "prog"), "symlink"},
+			{filepath.Join(tmpDir, "middle"), "symlink"},
+			{target, "file"},
+		}
+		if !reflect.DeepEqual(hops, expected) {
+			t.Errorf("Expected %v, got %v", expected, hops)
+		}
+	})
+
+	t.Run("--resolve prints only the final target", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--resolve", "--path", tmpDir, "prog"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stdout.String() != target+"\n" {
+			t.Errorf("Expected %s, got %q", target, stdout.String())
+		}
+	})
+
+	t.Run("--chain prints every hop", func(t *testing.T) {
+		for _, args := range [][]string{{"--chain"}, {"--chain", "--resolve"}} {
+			var stdout, stderr strings.Builder
+			if code := run(append(args, "--path", tmpDir, "prog"), nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			expected := filepath.Join(tmpDir, "prog") + ": symlink\n" +
+				"  -> " + filepath.Join(tmpDir, "middle") + ": symlink\n" +
+				"  -> " + target + ": file\n"
+			if stdout.String() != expected {
+				t.Errorf("Expected %q for %q, got %q", expected, args, stdout.String())
+			}
+		}
+	})
+
+	t.Run("stops at a broken middle link", func(t *testing.T) {
+		hops := traceLinks(filepath.Join(tmpDir, "broken"))
+		expected := []linkHop{
+			{filepath.Join(tmpDir, "broken"), "symlink"},
+			{filepath.Join(tmpDir, "broken-middle"), "symlink"},
+			{filepath.Join(tmpDir, "missing"), "missing"},
+		}
+		if !reflect.DeepEqual(hops, expected) {
+			t.Errorf("Expected %v, got %v", expected, hops)
+		}
+
+		var out strings.Builder
+		if err := writeLinks(&out, hops); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.Contains(out.String(), "missing (dangling link)") {
+			t.Errorf("Expected dangling marker, got %q", out.String())
+		}
+	})
+
+	t.Run("stops on a cycle", func(t *testing.T) {
+		if err := os.Symlink("loop-b", filepath.Join(tmpDir, "loop-a")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		if err := os.Symlink("loop-a", filepath.Join(tmpDir, "loop-b")); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+		hops := traceLinks(filepath.Join(tmpDir, "loop-a"))
+		if len(hops) != maxLinkHops+1 || hops[maxLinkHops].Status != "loop" {
+			t.Errorf("Expected %d hops ending in a loop marker, got %v", maxLinkHops+1, hops)
+		}
+	})
+}
+
+func TestDetectHardlinks(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	original := filepath.Join(first, "gzip"+exe)
+	if err := os.WriteFile(original, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	linked := filepath.Join(second, "gzip"+exe)
+	if err := os.Link(original, linked); err != nil {
+		t.Skipf("Hard links not supported: %v", err)
+	}
+	copied := filepath.Join(second, "gunzip"+exe)
+	if err := os.WriteFile(copied, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", strings.Join([]string{first, second}, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"-a", "--detect-hardlinks", "gzip", "gunzip"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+
+	expected := original + " (same file as " + linked + ")\n" +
+		linked + " (same file as " + original + ")\n" +
+		copied + "\n"
+	if !strings.EqualFold(stdout.String(), expected) {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestUniqueFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Symlinks require elevated privileges on Windows")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	linkDir := filepath.Join(tmpDir, "link")
+	realDir := filepath.Join(tmpDir, "real")
+	otherDir := filepath.Join(tmpDir, "other")
+	for _, dir := range []string{linkDir, realDir, otherDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	for _, path := range []string{filepath.Join(realDir, "tool"), filepath.Join(otherDir, "tool")} {
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(realDir, "tool"), filepath.Join(linkDir, "tool")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	path := strings.Join([]string{linkDir, realDir, otherDir}, string(os.PathListSeparator))
+	if err := os.Setenv("PATH", path); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := run([]string{"-a", "--unique-files", "tool"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+	}
+	expected := filepath.Join(linkDir, "tool") + " (same file as " + filepath.Join(realDir, "tool") + ")\n" +
+		filepath.Join(otherDir, "tool") + "\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+
+	t.Run("same path from two names", func(t *testing.T) {
+		results := []result{
+			{Name: "tool", Found: true, Path: filepath.Join(otherDir, "tool")},
+			{Name: "missing"},
+			{Name: "tool", Found: true, Path: filepath.Join(otherDir, "tool")},
+		}
+		results = uniqueFiles(results)
+		if len(results) != 2 || len(results[0].SameAs) != 0 {
+			t.Errorf("Expected the repeated path to be dropped silently, got %+v", results)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// retryDelay is the wait before the first retry; it doubles on each attempt.
+const retryDelay = 10 * time.Millisecond
+
+// statRetry calls stat for path, retrying up to retries times while it fails
+// with a transient error.
+func statRetry(path string, retries int, stat func(string) (os.FileInfo, error)) (os.FileInfo, error) {
+	delay := retryDelay
+	for attempt := 0; ; attempt++ {
+		info, err := stat(path)
+		if err == nil || attempt >= retries || !isTransient(err) {
+			return info, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func isTransient(err error) bool {
+	for _, transient := range transientErrors {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// transientErrors are stat failures that can succeed when retried, typically
+// seen on network filesystems.
+var transientErrors = []error{
+	syscall.EIO,
+	syscall.EAGAIN,
+	syscall.EINTR,
+	syscall.EBUSY,
+	syscall.ETIMEDOUT,
+	syscall.ESTALE,
+}
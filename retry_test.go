@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestStatRetry(t *testing.T) {
+	transient := &fs.PathError{Op: "stat", Path: "tool", Err: transientErrors[0]}
+
+	t.Run("retries transient errors until success", func(t *testing.T) {
+		calls := 0
+		stat := func(path string) (os.FileInfo, error) {
+			calls++
+			if calls < 3 {
+				return nil, transient
+			}
+			return os.Stat(os.TempDir())
+		}
+
+		if _, err := statRetry("tool", 2, stat); err != nil {
+			t.Errorf("Expected success after retries, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("Expected 3 calls, got %d", calls)
+		}
+	})
+
+	t.Run("gives up after the retry budget", func(t *testing.T) {
+		calls := 0
+		stat := func(path string) (os.FileInfo, error) {
+			calls++
+			return nil, transient
+		}
+
+		if _, err := statRetry("tool", 1, stat); err == nil {
+			t.Error("Expected an error")
+		}
+		if calls != 2 {
+			t.Errorf("Expected 2 calls, got %d", calls)
+		}
+	})
+
+	t.Run("does not retry a missing file", func(t *testing.T) {
+		calls := 0
+		stat := func(path string) (os.FileInfo, error) {
+			calls++
+			return nil, &fs.PathError{Op: "stat", Path: path, Err: syscall.ENOENT}
+		}
+
+		if _, err := statRetry("tool", 3, stat); err == nil {
+			t.Error("Expected an error")
+		}
+		if calls != 1 {
+			t.Errorf("Expected 1 call, got %d", calls)
+		}
+	})
+}
@@ -0,0 +1,13 @@
+package main
+
+import "syscall"
+
+// transientErrors are stat failures that can succeed when retried, typically
+// seen on SMB shares.
+var transientErrors = []error{
+	syscall.Errno(59),   // ERROR_UNEXP_NET_ERR
+	syscall.Errno(64),   // ERROR_NETNAME_DELETED
+	syscall.Errno(121),  // ERROR_SEM_TIMEOUT
+	syscall.Errno(170),  // ERROR_BUSY
+	syscall.Errno(1231), // ERROR_NETWORK_UNREACHABLE
+}
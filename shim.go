@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// maxShimSize bounds the files --unshim reads: shims are short scripts, so
+// anything larger is not one.
+const maxShimSize = 8 << 10
+
+// shimMarkers lists, per version manager, strings found in its shim scripts.
+// pyenv, rbenv, nodenv and goenv generate shims that export their root and
+// exec "<root>/libexec/<manager>" exec; asdf shims exec asdf and name the
+// plugin in a comment.
+var shimMarkers = []struct {
+	manager string
+	markers []string
+}{
+	{"pyenv", []string{"PYENV_ROOT", `pyenv" exec`}},
+	{"rbenv", []string{"RBENV_ROOT", `rbenv" exec`}},
+	{"nodenv", []string{"NODENV_ROOT", `nodenv" exec`}},
+	{"goenv", []string{"GOENV_ROOT", `goenv" exec`}},
+	{"asdf", []string{"asdf exec", "# asdf-plugin:"}},
+}
+
+// unwrapShim asks the version manager behind a shim which executable the
+// shim runs, with its which command, e.g. "pyenv which python". The manager
+// is looked up like any other program and run in the current directory,
+// since that is where local version files select the version.
+func unwrapShim(manager, path string, opts *options) (string, error) {
+	exe := findExecutable(manager, opts)
+	if exe == "" {
+		return "", fmt.Errorf("%s not found in PATH", manager)
+	}
+	name := commandName(path, getExtensions(opts))
+	out, err := exec.Command(exe, "which", name).Output()
+	if err != nil {
+		return "", fmt.Errorf("%s which %s: %w", manager, name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isScript reports whether the file at path starts with a "#!" line, for
+// --binary-only.
+func isScript(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer func() { _ = f.Close() }()
+
+	header := make([]byte, 2)
+	n, _ := io.ReadFull(f, header)
+	return bytes.Equal(header[:n], []byte("#!"))
+}
+
+// detectShim returns the version manager whose shim path is, or "" if path
+// does not look like a shim.
+func detectShim(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer func() { _ = f.Close() }()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxShimSize+1))
+	if err != nil || len(data) > maxShimSize || !bytes.HasPrefix(data, []byte("#!")) {
+		return ""
+	}
+	for _, shim := range shimMarkers {
+		for _, marker := range shim.markers {
+			if bytes.Contains(data, []byte(marker)) {
+				return shim.manager
+			}
+		}
+	}
+	return ""
+}
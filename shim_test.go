@@ -0,0 +1,247 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDetectShim(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name: "pyenv",
+			content: `#!/usr/bin/env bash
+set -e
+[ -n "$PYENV_DEBUG" ] && set -x
+
+program="${0##*/}"
+
+export PYENV_ROOT="/home/me/.pyenv"
+exec "/home/me/.pyenv/libexec/pyenv" exec "$program" "$@"
+`,
+			want: "pyenv",
+		},
+		{
+			name: "rbenv",
+			content: `#!/usr/bin/env bash
+set -e
+[ -n "$RBENV_DEBUG" ] && set -x
+
+program="${0##*/}"
+
+export RBENV_ROOT="/home/me/.rbenv"
+exec "/usr/lib/rbenv/libexec/rbenv" exec "$program" "$@"
+`,
+			want: "rbenv",
+		},
+		{
+			name: "asdf",
+			content: `#!/usr/bin/env bash
+# asdf-plugin: nodejs 20.11.0
+exec /home/me/.asdf/bin/asdf exec "node" "$@" # asdf_allow: ' asdf '
+`,
+			want: "asdf",
+		},
+		{
+			name:    "plain script",
+			content: "#!/bin/sh\nexec /usr/bin/python3 \"$@\"\n",
+			want:    "",
+		},
+		{
+			name:    "binary mentioning a marker",
+			content: "\x7fELF\x00PYENV_ROOT",
+			want:    "",
+		},
+		{
+			name:    "large script",
+			content: "#!/bin/sh\n# PYENV_ROOT\n" + strings.Repeat("#\n", maxShimSize),
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmpDir, strings.ReplaceAll(tt.name, " ", "-"))
+			if err := os.WriteFile(path, []byte(tt.content), 0755); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if got := detectShim(path); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		if got := detectShim(filepath.Join(tmpDir, "nonexistent")); got != "" {
+			t.Errorf("Expected no shim, got %q", got)
+		}
+	})
+}
+
+func TestUnwrap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake version manager is a shell script")
+	}
+
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	shimsDir := filepath.Join(tmpDir, "shims")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{shimsDir, binDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	shim := filepath.Join(shimsDir, "python")
+	shimScript := "#!/usr/bin/env bash\nexport PYENV_ROOT=\"/opt/pyenv\"\nexec \"/opt/pyenv/libexec/pyenv\" exec \"$program\" \"$@\"\n"
+	if err := os.WriteFile(shim, []byte(shimScript), 0755); err != nil {
+		t.Fatalf("Failed to create shim: %v", err)
+	}
+
+	target := filepath.Join(tmpDir, "versions", "3.12.1", "bin", "python")
+	manager := "#!/bin/sh\n[ \"$1\" = which ] && [ \"$2\" = python ] && echo " + target + "\n"
+	if err := os.WriteFile(filepath.Join(binDir, "pyenv"), []byte(manager), 0755); err != nil {
+		t.Fatalf("Failed to create fake pyenv: %v", err)
+	}
+
+	pathList := strings.Join([]string{shimsDir, binDir}, string(os.PathListSeparator))
+	if err := os.Setenv("PATH", pathList); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("reports the target", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--unwrap", "python"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := shim + " (pyenv shim -> " + target + ")\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+	})
+
+	t.Run("manager missing", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--unwrap", "--path", shimsDir, "python"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if expected := shim + " (pyenv shim)\n"; stdout.String() != expected {
+			t.Errorf("Expected %q, got %q", expected, stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "pyenv not found in PATH") {
+			t.Errorf("Expected a warning about pyenv, got %q", stderr.String())
+		}
+	})
+}
+
+func TestBinaryOnly(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	scripts := filepath.Join(tmpDir, "scripts")
+	bin := filepath.Join(tmpDir, "bin")
+	contents := map[string]string{
+		scripts: "#!/bin/sh\nexec /usr/bin/tool \"$@\"\n",
+		bin:     "\x7fELF\x02\x01\x01",
+	}
+	for dir, content := range contents {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "tool"+exe), []byte(content), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	script := filepath.Join(scripts, "tool"+exe)
+	binary := filepath.Join(bin, "tool"+exe)
+
+	if err := os.Setenv("PATH", scripts+string(os.PathListSeparator)+bin); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"default", []string{"tool"}, script + "\n"},
+		{"binary only", []string{"--binary-only", "tool"}, binary + "\n"},
+		{"all", []string{"-a", "--binary-only", "tool"}, binary + "\n"},
+		{"glob", []string{"--glob", "--binary-only", "to*"}, binary + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			args := append([]string{"--skip-dot"}, tt.args...)
+			if code := run(args, nil, &stdout, &stderr); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if !strings.EqualFold(stdout.String(), tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+
+	t.Run("only a script", func(t *testing.T) {
+		if err := os.Setenv("PATH", scripts); err != nil {
+			t.Fatalf("Failed to set PATH: %v", err)
+		}
+
+		var stdout, stderr strings.Builder
+		code := run([]string{"--skip-dot", "--binary-only", "--format", "json", "tool"}, nil, &stdout, &stderr)
+		if code != exitNotFound {
+			t.Fatalf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if !strings.Contains(stdout.String(), `"script_skipped"`) {
+			t.Errorf("Expected reason script_skipped, got %s", stdout.String())
+		}
+		if !strings.Contains(stderr.String(), "skipped by --binary-only") {
+			t.Errorf("Expected the script to be named as skipped, got %q", stderr.String())
+		}
+
+		stdout.Reset()
+		run([]string{"explain", "--skip-dot", "--binary-only", "tool"}, nil, &stdout, &stderr)
+		want := "Trying " + script + "... a script, skipped (--binary-only)."
+		if !strings.Contains(strings.ToLower(stdout.String()), strings.ToLower(want)) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, stdout.String())
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// shellDefinitions holds the aliases and function names read from stdin for
+// --type-a.
+type shellDefinitions struct {
+	aliases   map[string]string
+	functions map[string]bool
+}
+
+// readDefinitions parses the output of "alias; declare -F" in bash, or
+// "alias; typeset +f" in zsh: alias definitions as read by readAliases, and
+// function names given as "declare -f name", "name ()", "function name" or a
+// bare name. Function bodies, as printed by "declare -f", are skipped.
+func readDefinitions(r io.Reader) (*shellDefinitions, error) {
+	defs := &shellDefinitions{
+		aliases:   make(map[string]string),
+		functions: make(map[string]bool),
+	}
+
+	depth := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if depth > 0 || line == "{" {
+			depth += strings.Count(line, "{") - strings.Count(line, "}")
+			continue
+		}
+		if name, value, ok := parseAlias(line); ok {
+			defs.aliases[name] = value
+			continue
+		}
+		if name := functionName(line); name != "" {
+			defs.functions[name] = true
+			depth = strings.Count(line, "{") - strings.Count(line, "}")
+		}
+	}
+	return defs, scanner.Err()
+}
+
+// functionName returns the function a definition line names, or "" if the
+// line does not name one.
+func functionName(line string) string {
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) >= 3 && fields[0] == "declare" && strings.HasPrefix(fields[1], "-f"):
+		return fields[2]
+	case len(fields) >= 2 && fields[0] == "function":
+		return strings.TrimSuffix(fields[1], "()")
+	case len(fields) >= 1 && strings.HasSuffix(fields[0], "()"):
+		return strings.TrimSuffix(fields[0], "()")
+	case len(fields) >= 2 && strings.HasPrefix(fields[1], "()"):
+		return fields[0]
+	case len(fields) == 1 && !strings.ContainsAny(line, "{}();=$"):
+		return line
+	}
+	return ""
+}
+
+// runTypeA prints what each name refers to, in the order bash's "type -a"
+// reports it: an alias read from stdin, a function read from stdin, and then
+// every match in PATH. A name with none of them is not found.
+func runTypeA(stdin io.Reader, stdout, stderr io.Writer, opts *options) int {
+	defs, err := readDefinitions(stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "reading definitions: %v\n", err)
+		return exitFailure
+	}
+
+	status := 0
+	for _, name := range opts.names {
+		var lines []string
+		if value, ok := defs.aliases[name]; ok {
+			lines = append(lines, fmt.Sprintf("%s is aliased to `%s'", name, value))
+		}
+		if defs.functions[name] {
+			lines = append(lines, fmt.Sprintf("%s is a function", name))
+		}
+		for _, path := range findAllExecutables(name, opts) {
+			lines = append(lines, fmt.Sprintf("%s is %s", name, abbreviatePath(path, opts)))
+		}
+
+		if len(lines) == 0 {
+			_, _ = fmt.Fprintf(stderr, "%s not found\n", name)
+			status = opts.notFoundStatus()
+			continue
+		}
+		for _, line := range lines {
+			if _, err := fmt.Fprintln(stdout, line); err != nil {
+				_, _ = fmt.Fprintln(stderr, err)
+				return exitFailure
+			}
+		}
+	}
+	return status
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadDefinitions(t *testing.T) {
+	input := strings.Join([]string{
+		"alias ll='ls -l'",
+		"declare -f greet",
+		"declare -fx exported",
+		"body () ",
+		"{ ",
+		"    echo 'not a function'",
+		"}",
+		"function legacy {",
+		"    true",
+		"}",
+		"zshfunc",
+	}, "\n")
+
+	defs, err := readDefinitions(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if defs.aliases["ll"] != "ls -l" || len(defs.aliases) != 1 {
+		t.Errorf("Expected alias ll='ls -l', got %v", defs.aliases)
+	}
+	expected := []string{"greet", "exported", "body", "legacy", "zshfunc"}
+	for _, name := range expected {
+		if !defs.functions[name] {
+			t.Errorf("Expected function %s, got %v", name, defs.functions)
+		}
+	}
+	if len(defs.functions) != len(expected) {
+		t.Errorf("Expected %d functions, got %v", len(expected), defs.functions)
+	}
+}
+
+func TestTypeA(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	var dirs, paths []string
+	for _, name := range []string{"first", "second"} {
+		dir := filepath.Join(tmpDir, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		path := filepath.Join(dir, "ls"+exe)
+		if err := os.WriteFile(path, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		dirs = append(dirs, dir)
+		paths = append(paths, path)
+	}
+
+	if err := os.Setenv("PATH", strings.Join(dirs, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("alias, function and PATH matches", func(t *testing.T) {
+		stdin := strings.NewReader("alias ls='ls --color=auto'\ndeclare -f ls\n")
+		var stdout, stderr strings.Builder
+		code := run([]string{"--type-a", "ls"}, stdin, &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+
+		expected := []string{
+			"ls is aliased to `ls --color=auto'",
+			"ls is a function",
+			"ls is " + paths[0],
+			"ls is " + paths[1],
+		}
+		lines := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+		if len(lines) != len(expected) {
+			t.Fatalf("Expected %d lines, got %q", len(expected), stdout.String())
+		}
+		for i := range expected {
+			if !strings.EqualFold(lines[i], expected[i]) {
+				t.Errorf("Expected %s, got %s", expected[i], lines[i])
+			}
+		}
+	})
+
+	t.Run("function only", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--type-a", "greet"}, strings.NewReader("greet () \n{ \n    echo hi\n}\n"), &stdout, &stderr)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stdout.String() != "greet is a function\n" {
+			t.Errorf("Expected greet is a function, got %q", stdout.String())
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		code := run([]string{"--type-a", "missing"}, strings.NewReader("alias ll='ls -l'\n"), &stdout, &stderr)
+		if code != exitNotFound {
+			t.Errorf("Expected exit code %d, got %d", exitNotFound, code)
+		}
+		if stderr.String() != "missing not found\n" {
+			t.Errorf("Expected not found message, got %q", stderr.String())
+		}
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+// uncPath returns path unchanged: drive mappings exist only on Windows.
+func uncPath(path string) string {
+	return path
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestUNCPath(t *testing.T) {
+	if runtime.GOOS != "windows" {
+		t.Skip("Mapped drives are Windows-specific")
+	}
+
+	t.Run("local drive is unchanged", func(t *testing.T) {
+		path := filepath.Join(os.Getenv("SystemDrive")+`\`, "Windows", "notepad.exe")
+		if result := uncPath(path); result != path {
+			t.Errorf("Expected %s, got %s", path, result)
+		}
+	})
+
+	t.Run("UNC path is unchanged", func(t *testing.T) {
+		path := `\\server\share\bin\tool.exe`
+		if result := uncPath(path); result != path {
+			t.Errorf("Expected %s, got %s", path, result)
+		}
+	})
+
+	t.Run("mapped drive", func(t *testing.T) {
+		for letter := 'A'; letter <= 'Z'; letter++ {
+			root := string(letter) + `:\`
+			share := uncPath(root)
+			if share == root {
+				continue
+			}
+			if !strings.HasPrefix(share, `\\`) {
+				t.Errorf("Expected a UNC path for %s, got %s", root, share)
+			}
+			path := string(letter) + `:\bin\tool.exe`
+			expected := share + `bin\tool.exe`
+			if result := uncPath(path); result != expected {
+				t.Errorf("Expected %s, got %s", expected, result)
+			}
+			return
+		}
+		t.Skip("No mapped network drive")
+	})
+}
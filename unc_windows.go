@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+var procWNetGetConnection = syscall.NewLazyDLL("mpr.dll").NewProc("WNetGetConnectionW")
+
+// uncPath returns path with a mapped network drive replaced by the UNC path
+// of the share it maps, e.g. Z:\bin\tool.exe as \\server\share\bin\tool.exe.
+// Paths on local drives, or already in UNC form, are returned unchanged.
+func uncPath(path string) string {
+	drive := filepath.VolumeName(path)
+	if len(drive) != 2 || drive[1] != ':' {
+		return path
+	}
+	remote, ok := driveConnection(drive)
+	if !ok {
+		return path
+	}
+	return remote + path[len(drive):]
+}
+
+// driveConnection returns the share a drive letter such as "Z:" is mapped
+// to, as reported by WNetGetConnectionW.
+func driveConnection(drive string) (string, bool) {
+	local, err := syscall.UTF16PtrFromString(drive)
+	if err != nil {
+		return "", false
+	}
+
+	size := uint32(syscall.MAX_PATH)
+	// The first call reports the size needed if the buffer is too small.
+	for range 2 {
+		buf := make([]uint16, size)
+		r, _, _ := procWNetGetConnection.Call(
+			uintptr(unsafe.Pointer(local)),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(unsafe.Pointer(&size)),
+		)
+		switch syscall.Errno(r) {
+		case 0:
+			return syscall.UTF16ToString(buf), true
+		case syscall.ERROR_MORE_DATA:
+			continue
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// decompositions maps precomposed letters to a base letter and a combining
+// mark, for the Latin-1 Supplement and Latin Extended-A blocks. That covers
+// the accented names seen in practice without pulling in a full Unicode
+// normalization library; other characters are left as they are.
+var decompositions = map[rune][2]rune{
+	'À': {'A', 0x0300},
+	'Á': {'A', 0x0301},
+	'Â': {'A', 0x0302},
+	'Ã': {'A', 0x0303},
+	'Ä': {'A', 0x0308},
+	'Å': {'A', 0x030A},
+	'Ç': {'C', 0x0327},
+	'È': {'E', 0x0300},
+	'É': {'E', 0x0301},
+	'Ê': {'E', 0x0302},
+	'Ë': {'E', 0x0308},
+	'Ì': {'I', 0x0300},
+	'Í': {'I', 0x0301},
+	'Î': {'I', 0x0302},
+	'Ï': {'I', 0x0308},
+	'Ñ': {'N', 0x0303},
+	'Ò': {'O', 0x0300},
+	'Ó': {'O', 0x0301},
+	'Ô': {'O', 0x0302},
+	'Õ': {'O', 0x0303},
+	'Ö': {'O', 0x0308},
+	'Ù': {'U', 0x0300},
+	'Ú': {'U', 0x0301},
+	'Û': {'U', 0x0302},
+	'Ü': {'U', 0x0308},
+	'Ý': {'Y', 0x0301},
+	'à': {'a', 0x0300},
+	'á': {'a', 0x0301},
+	'â': {'a', 0x0302},
+	'ã': {'a', 0x0303},
+	'ä': {'a', 0x0308},
+	'å': {'a', 0x030A},
+	'ç': {'c', 0x0327},
+	'è': {'e', 0x0300},
+	'é': {'e', 0x0301},
+	'ê': {'e', 0x0302},
+	'ë': {'e', 0x0308},
+	'ì': {'i', 0x0300},
+	'í': {'i', 0x0301},
+	'î': {'i', 0x0302},
+	'ï': {'i', 0x0308},
+	'ñ': {'n', 0x0303},
+	'ò': {'o', 0x0300},
+	'ó': {'o', 0x0301},
+	'ô': {'o', 0x0302},
+	'õ': {'o', 0x0303},
+	'ö': {'o', 0x0308},
+	'ù': {'u', 0x0300},
+	'ú': {'u', 0x0301},
+	'û': {'u', 0x0302},
+	'ü': {'u', 0x0308},
+	'ý': {'y', 0x0301},
+	'ÿ': {'y', 0x0308},
+	'Ā': {'A', 0x0304},
+	'ā': {'a', 0x0304},
+	'Ă': {'A', 0x0306},
+	'ă': {'a', 0x0306},
+	'Ą': {'A', 0x0328},
+	'ą': {'a', 0x0328},
+	'Ć': {'C', 0x0301},
+	'ć': {'c', 0x0301},
+	'Ĉ': {'C', 0x0302},
+	'ĉ': {'c', 0x0302},
+	'Ċ': {'C', 0x0307},
+	'ċ': {'c', 0x0307},
+	'Č': {'C', 0x030C},
+	'č': {'c', 0x030C},
+	'Ď': {'D', 0x030C},
+	'ď': {'d', 0x030C},
+	'Ē': {'E', 0x0304},
+	'ē': {'e', 0x0304},
+	'Ĕ': {'E', 0x0306},
+	'ĕ': {'e', 0x0306},
+	'Ė': {'E', 0x0307},
+	'ė': {'e', 0x0307},
+	'Ę': {'E', 0x0328},
+	'ę': {'e', 0x0328},
+	'Ě': {'E', 0x030C},
+	'ě': {'e', 0x030C},
+	'Ĝ': {'G', 0x0302},
+	'ĝ': {'g', 0x0302},
+	'Ğ': {'G', 0x0306},
+	'ğ': {'g', 0x0306},
+	'Ġ': {'G', 0x0307},
+	'ġ': {'g', 0x0307},
+	'Ģ': {'G', 0x0327},
+	'ģ': {'g', 0x0327},
+	'Ĥ': {'H', 0x0302},
+	'ĥ': {'h', 0x0302},
+	'Ĩ': {'I', 0x0303},
+	'ĩ': {'i', 0x0303},
+	'Ī': {'I', 0x0304},
+	'ī': {'i', 0x0304},
+	'Ĭ': {'I', 0x0306},
+	'ĭ': {'i', 0x0306},
+	'Į': {'I', 0x0328},
+	'į': {'i', 0x0328},
+	'İ': {'I', 0x0307},
+	'Ĵ': {'J', 0x0302},
+	'ĵ': {'j', 0x0302},
+	'Ķ': {'K', 0x0327},
+	'ķ': {'k', 0x0327},
+	'Ĺ': {'L', 0x0301},
+	'ĺ': {'l', 0x0301},
+	'Ļ': {'L', 0x0327},
+	'ļ': {'l', 0x0327},
+	'Ľ': {'L', 0x030C},
+	'ľ': {'l', 0x030C},
+	'Ń': {'N', 0x0301},
+	'ń': {'n', 0x0301},
+	'Ņ': {'N', 0x0327},
+	'ņ': {'n', 0x0327},
+	'Ň': {'N', 0x030C},
+	'ň': {'n', 0x030C},
+	'Ō': {'O', 0x0304},
+	'ō': {'o', 0x0304},
+	'Ŏ': {'O', 0x0306},
+	'ŏ': {'o', 0x0306},
+	'Ő': {'O', 0x030B},
+	'ő': {'o', 0x030B},
+	'Ŕ': {'R', 0x0301},
+	'ŕ': {'r', 0x0301},
+	'Ŗ': {'R', 0x0327},
+	'ŗ': {'r', 0x0327},
+	'Ř': {'R', 0x030C},
+	'ř': {'r', 0x030C},
+	'Ś': {'S', 0x0301},
+	'ś': {'s', 0x0301},
+	'Ŝ': {'S', 0x0302},
+	'ŝ': {'s', 0x0302},
+	'Ş': {'S', 0x0327},
+	'ş': {'s', 0x0327},
+	'Š': {'S', 0x030C},
+	'š': {'s', 0x030C},
+	'Ţ': {'T', 0x0327},
+	'ţ': {'t', 0x0327},
+	'Ť': {'T', 0x030C},
+	'ť': {'t', 0x030C},
+	'Ũ': {'U', 0x0303},
+	'ũ': {'u', 0x0303},
+	'Ū': {'U', 0x0304},
+	'ū': {'u', 0x0304},
+	'Ŭ': {'U', 0x0306},
+	'ŭ': {'u', 0x0306},
+	'Ů': {'U', 0x030A},
+	'ů': {'u', 0x030A},
+	'Ű': {'U', 0x030B},
+	'ű': {'u', 0x030B},
+	'Ų': {'U', 0x0328},
+	'ų': {'u', 0x0328},
+	'Ŵ': {'W', 0x0302},
+	'ŵ': {'w', 0x0302},
+	'Ŷ': {'Y', 0x0302},
+	'ŷ': {'y', 0x0302},
+	'Ÿ': {'Y', 0x0308},
+	'Ź': {'Z', 0x0301},
+	'ź': {'z', 0x0301},
+	'Ż': {'Z', 0x0307},
+	'ż': {'z', 0x0307},
+	'Ž': {'Z', 0x030C},
+	'ž': {'z', 0x030C},
+}
+
+// compositions is the inverse of decompositions.
+var compositions = func() map[[2]rune]rune {
+	m := make(map[[2]rune]rune, len(decompositions))
+	for composed, pair := range decompositions {
+		m[pair] = composed
+	}
+	return m
+}()
+
+// toNFD decomposes the letters of s that are in decompositions.
+func toNFD(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if pair, ok := decompositions[r]; ok {
+			b.WriteRune(pair[0])
+			b.WriteRune(pair[1])
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// toNFC composes the base letter and combining mark pairs of s that are in
+// compositions.
+func toNFC(s string) string {
+	runes := []rune(s)
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		if i+1 < len(runes) {
+			if composed, ok := compositions[[2]rune{runes[i], runes[i+1]}]; ok {
+				b.WriteRune(composed)
+				i++
+				continue
+			}
+		}
+		b.WriteRune(runes[i])
+	}
+	return b.String()
+}
+
+// normalizationForms returns name followed by its NFC and NFD forms where
+// they differ from it, for --unicode-normalize. macOS HFS+ stores names
+// decomposed, while names typed or pasted elsewhere are usually composed.
+func normalizationForms(name string) []string {
+	forms := []string{name}
+	for _, form := range []string{toNFC(name), toNFD(name)} {
+		if !slices.Contains(forms, form) {
+			forms = append(forms, form)
+		}
+	}
+	return forms
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNormalizationForms(t *testing.T) {
+	composed := "café-résumé"
+	decomposed := "cafe\u0301-re\u0301sume\u0301"
+
+	if result := toNFD(composed); result != decomposed {
+		t.Errorf("Expected %q, got %q", decomposed, result)
+	}
+	if result := toNFC(decomposed); result != composed {
+		t.Errorf("Expected %q, got %q", composed, result)
+	}
+
+	forms := normalizationForms(decomposed)
+	if len(forms) != 2 || forms[0] != decomposed || forms[1] != composed {
+		t.Errorf("Expected %q and %q, got %q", decomposed, composed, forms)
+	}
+	if forms := normalizationForms("plain"); len(forms) != 1 {
+		t.Errorf("Expected a single form for an ASCII name, got %q", forms)
+	}
+}
+
+func TestUnicodeNormalize(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	// Stored decomposed, as HFS+ on macOS does, and looked up composed.
+	exeName := "cafe\u0301"
+	if runtime.GOOS == "windows" {
+		exeName += ".exe"
+	}
+	exe := filepath.Join(tmpDir, exeName)
+	if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	if runtime.GOOS == "linux" {
+		t.Run("exact match only by default", func(t *testing.T) {
+			if result := findExecutable("café", &options{}); result != "" {
+				t.Errorf("Expected empty string, got %q", result)
+			}
+		})
+	}
+
+	t.Run("composed name finds decomposed file", func(t *testing.T) {
+		result := findExecutable("café", &options{unicodeNormalize: true})
+		if result == "" || !strings.EqualFold(filepath.Dir(result), tmpDir) {
+			t.Errorf("Expected a match in %s, got %q", tmpDir, result)
+		}
+	})
+}
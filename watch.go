@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultWatchInterval is how often --watch polls without --watch-interval.
+const defaultWatchInterval = 2 * time.Second
+
+// runWatch prints the matches for each name, then polls every
+// opts.watchInterval and prints a name again whenever its matches change:
+// a different path, or the same path with a new size or modification time.
+// Changes to PATH in the calling shell are not visible to a running
+// process, so PATH stays as it was at startup. It returns when ctx is done.
+func runWatch(ctx context.Context, stdout, stderr io.Writer, opts *options) int {
+	interval := opts.watchInterval
+	if interval == 0 {
+		interval = defaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	states := make(map[string]string)
+	for {
+		for _, name := range opts.names {
+			found := lookup(name, opts)
+
+			state := watchState(found)
+			if prev, ok := states[name]; ok && prev == state {
+				continue
+			}
+			states[name] = state
+
+			if opts.silent {
+				continue
+			}
+			if !found[0].Found {
+				_, _ = fmt.Fprintf(stderr, "%s not found in PATH\n", name)
+				continue
+			}
+			if opts.firstDir {
+				found = found[:1]
+			}
+			annotate(stderr, found, opts)
+			for i := range found {
+				abbreviate(&found[i], opts)
+			}
+			if err := render(stdout, found, opts); err != nil {
+				_, _ = fmt.Fprintln(stderr, err)
+				return exitFailure
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchState summarizes the matches of one name so that --watch can tell
+// when they change.
+func watchState(found []result) string {
+	var b strings.Builder
+	for _, r := range found {
+		if !r.Found {
+			continue
+		}
+		b.WriteString(r.Path)
+		if info, err := os.Stat(r.Path); err == nil {
+			_, _ = fmt.Fprintf(&b, " %d %d", info.Size(), info.ModTime().UnixNano())
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
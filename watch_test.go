@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuilder is a strings.Builder that can be read while runWatch writes.
+type syncBuilder struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuilder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuilder) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for watch output")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if runtime.GOOS == "windows" {
+		if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+			tmpDir = resolved
+		}
+	}
+
+	exeName := "watched"
+	if runtime.GOOS == "windows" {
+		exeName = "watched.exe"
+	}
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	secondExe := filepath.Join(second, exeName)
+	if err := os.WriteFile(secondExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := os.Setenv("PATH", strings.Join([]string{first, second}, string(os.PathListSeparator))); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr syncBuilder
+	opts := &options{names: []string{"watched"}, format: "plain", watch: true, watchInterval: 10 * time.Millisecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- runWatch(ctx, &stdout, &stderr, opts) }()
+
+	waitFor(t, func() bool { return strings.Count(stdout.String(), "\n") == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if lines := strings.Count(stdout.String(), "\n"); lines != 1 {
+		t.Errorf("Expected no output while nothing changes, got %d lines", lines)
+	}
+
+	firstExe := filepath.Join(first, exeName)
+	if err := os.WriteFile(firstExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	waitFor(t, func() bool { return strings.Count(stdout.String(), "\n") == 2 })
+
+	cancel()
+	if code := <-done; code != 0 {
+		t.Errorf("Expected exit code 0, got %d", code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if !strings.EqualFold(lines[0], secondExe) || !strings.EqualFold(lines[1], firstExe) {
+		t.Errorf("Expected %s then %s, got %v", secondExe, firstExe, lines)
+	}
+}
+
+func TestRunWatchAnnotations(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	exeName := "watched"
+	if runtime.GOOS == "windows" {
+		exeName = "watched.exe"
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, exeName), []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := os.Setenv("PATH", tmpDir); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	var stdout, stderr syncBuilder
+	opts := &options{
+		names:         []string{"watched"},
+		format:        "plain",
+		watch:         true,
+		watchInterval: 10 * time.Millisecond,
+		skipDot:       true,
+		printSource:   true,
+		checksum:      "sha256",
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan int)
+	go func() { done <- runWatch(ctx, &stdout, &stderr, opts) }()
+
+	waitFor(t, func() bool { return strings.Count(stdout.String(), "\n") == 1 })
+	cancel()
+	<-done
+
+	for _, annotation := range []string{"PATH[0]", "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"} {
+		if !strings.Contains(stdout.String(), annotation) {
+			t.Errorf("Expected %s in the watch output, got %q", annotation, stdout.String())
+		}
+	}
+}
+
+func TestRunWatchOutputOptions(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exeName := "watched"
+	if runtime.GOOS == "windows" {
+		exeName = "watched.exe"
+	}
+	first := filepath.Join(tmpDir, "first")
+	second := filepath.Join(tmpDir, "second")
+	for _, dir := range []string{first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, exeName), []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	if err := os.Setenv("PATH", first+string(os.PathListSeparator)+second); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	// A canceled context makes runWatch return after its first pass.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		opts     options
+		expected string
+	}{
+		{"first dir", options{all: true, firstDir: true}, first + "\n"},
+		{"silent", options{all: true, silent: true}, ""},
+		{"silent not found", options{silent: true, names: []string{"which-test-missing"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts.names == nil {
+				opts.names = []string{"watched"}
+			}
+			opts.format = "plain"
+			opts.watch = true
+			opts.skipDot = true
+
+			var stdout, stderr syncBuilder
+			if code := runWatch(ctx, &stdout, &stderr, &opts); code != 0 {
+				t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+			}
+			if stdout.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, stdout.String())
+			}
+			if tt.opts.silent && stderr.String() != "" {
+				t.Errorf("Expected no diagnostics, got %q", stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// runWhatname reports the command name the file at path is invoked as and
+// whether resolving that name on PATH reaches this file.
+func runWhatname(w io.Writer, path string, opts *options) int {
+	info, err := os.Stat(path)
+	if err != nil {
+		_, _ = fmt.Fprintln(opts.stderr, err)
+		return exitFailure
+	}
+
+	name := commandName(path, getExtensions(opts))
+	winner := findExecutable(name, opts)
+
+	switch {
+	case winner == "":
+		_, _ = fmt.Fprintf(w, "%s: not on PATH\n", name)
+		return exitFailure
+	case isSameFile(info, winner):
+		_, _ = fmt.Fprintf(w, "%s: active (%s)\n", name, winner)
+		return 0
+	default:
+		_, _ = fmt.Fprintf(w, "%s: shadowed by %s\n", name, winner)
+		return exitFailure
+	}
+}
+
+func isSameFile(info os.FileInfo, path string) bool {
+	other, err := os.Stat(path)
+	return err == nil && os.SameFile(info, other)
+}
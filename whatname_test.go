@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWhatname(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir1, err := os.MkdirTemp("", "which-test1")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir1) })
+
+	tmpDir2, err := os.MkdirTemp("", "which-test2")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir2) })
+
+	offPathDir, err := os.MkdirTemp("", "which-test-off")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(offPathDir) })
+
+	exeName := "python3"
+	if runtime.GOOS == "windows" {
+		exeName = "python3.exe"
+	}
+	active := filepath.Join(tmpDir1, exeName)
+	shadowed := filepath.Join(tmpDir2, exeName)
+	unique := filepath.Join(offPathDir, "unique")
+	for _, exe := range []string{active, shadowed, unique} {
+		if err := os.WriteFile(exe, []byte("test"), 0755); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+
+	if err := os.Setenv("PATH", tmpDir1+string(os.PathListSeparator)+tmpDir2); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		code     int
+		expected string
+	}{
+		{"active binary", active, 0, "python3: active"},
+		{"shadowed binary", shadowed, exitFailure, "python3: shadowed by"},
+		{"binary not on PATH", unique, exitFailure, "unique: not on PATH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			code := run([]string{"--whatname", tt.path}, nil, &stdout, &stderr)
+			if code != tt.code {
+				t.Errorf("Expected exit code %d, got %d (stderr: %s)", tt.code, code, stderr.String())
+			}
+			if !strings.HasPrefix(stdout.String(), tt.expected) {
+				t.Errorf("Expected output starting with %q, got %q", tt.expected, stdout.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// foundWhy describes how the search found m for name, for --why.
+func foundWhy(name string, m match, opts *options) []string {
+	var why []string
+	switch {
+	case m.source == sourceExplicit:
+		why = append(why, "explicit path")
+		if !opts.relative && !filepath.IsAbs(name) {
+			why = append(why, "made absolute (--relative keeps it as given)")
+		}
+	case m.source == sourceCwd:
+		why = append(why, "found in the current directory (Windows implicit)")
+	case m.source == sourceDefault:
+		why = append(why, "found in the default path (PATH is unset)")
+	case m.source == sourceDir && opts.dir != "":
+		why = append(why, "found in "+opts.dir+" (--dir)")
+	case m.source == sourceDir:
+		why = append(why, "found in a directory outside PATH (--only-dir)")
+	default:
+		why = append(why, "found in "+m.source)
+	}
+
+	if opts.glob {
+		why = append(why, fmt.Sprintf("matched pattern %s (--glob)", name))
+	} else if ext := appendedExtension(filepath.Base(name), filepath.Base(m.path)); ext != "" {
+		why = append(why, fmt.Sprintf("extension %s appended (%s)", ext, pathExtSource(opts)))
+	}
+	return why
+}
+
+// appendedExtension returns the extension the search added to name to reach
+// base, or "" if base is name itself.
+func appendedExtension(name, base string) string {
+	if runtime.GOOS != "windows" || len(base) <= len(name) || !strings.EqualFold(base[:len(name)], name) {
+		return ""
+	}
+	return base[len(name):]
+}
+
+// printWhy writes a one-line summary of how r was found and what was done to
+// it before printing, such as "found in PATH[2]; symlink resolved (--resolve)".
+func printWhy(w io.Writer, r result, opts *options) {
+	why := r.Why
+	if r.Resolved != "" && r.Resolved != r.Path {
+		why = append(why, fmt.Sprintf("symlink resolved to %s (--resolve)", r.Resolved))
+	}
+	if opts.unc && strings.HasPrefix(r.Path, `\\`) {
+		why = append(why, "mapped drive converted to UNC (--unc)")
+	}
+	if r.Unwrapped != "" {
+		why = append(why, fmt.Sprintf("%s shim unwrapped to %s (--unwrap)", r.Shim, r.Unwrapped))
+	} else if r.Shim != "" {
+		why = append(why, fmt.Sprintf("%s shim (--unshim)", r.Shim))
+	}
+	if path := r.displayPath(); abbreviatePath(path, opts) != path {
+		why = append(why, fmt.Sprintf("printed as %s (%s)", abbreviatePath(path, opts), abbreviationFlag(opts)))
+	}
+	if len(why) == 0 {
+		return
+	}
+	_, _ = fmt.Fprintf(w, "why %s: %s\n", r.Path, strings.Join(why, "; "))
+}
+
+// abbreviationFlag names the flag abbreviatePath applied.
+func abbreviationFlag(opts *options) string {
+	switch {
+	case opts.relTo != "":
+		return "--rel-to"
+	case opts.showDot && opts.showTilde:
+		return "--show-dot, --show-tilde"
+	case opts.showDot:
+		return "--show-dot"
+	}
+	return "--show-tilde"
+}
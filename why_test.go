@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWhy(t *testing.T) {
+	originalPath := os.Getenv("PATH")
+	t.Cleanup(func() { _ = os.Setenv("PATH", originalPath) })
+
+	tmpDir, err := os.MkdirTemp("", "which-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(tmpDir) })
+
+	if resolved, err := filepath.EvalSymlinks(tmpDir); err == nil {
+		tmpDir = resolved
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	emptyDir := filepath.Join(tmpDir, "empty")
+	binDir := filepath.Join(tmpDir, "bin")
+	for _, dir := range []string{emptyDir, binDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+	testExe := filepath.Join(binDir, "prog"+exe)
+	if err := os.WriteFile(testExe, []byte("test"), 0755); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	pathList := strings.Join([]string{emptyDir, binDir}, string(os.PathListSeparator))
+	if err := os.Setenv("PATH", pathList); err != nil {
+		t.Fatalf("Failed to set PATH: %v", err)
+	}
+
+	t.Run("PATH entry", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--why", "prog"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if !strings.Contains(stderr.String(), "found in PATH[1]") {
+			t.Errorf("Expected found in PATH[1], got %q", stderr.String())
+		}
+		if runtime.GOOS == "windows" && !strings.Contains(stderr.String(), "extension .exe appended") {
+			t.Errorf("Expected extension .exe appended, got %q", stderr.String())
+		}
+	})
+
+	t.Run("explicit path", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--why", "--rel-to", tmpDir, filepath.Join(binDir, "prog")}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := "explicit path; printed as " + filepath.Join("bin", "prog"+exe) + " (--rel-to)"
+		if !strings.Contains(stderr.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+
+	t.Run("resolved symlink", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("Windows results are already normalized through symlinks")
+		}
+		link := filepath.Join(emptyDir, "linked"+exe)
+		if err := os.Symlink(testExe, link); err != nil {
+			t.Skipf("Cannot create symlink (requires privilege or developer mode on Windows): %v", err)
+		}
+		t.Cleanup(func() { _ = os.Remove(link) })
+
+		var stdout, stderr strings.Builder
+		if code := run([]string{"--why", "--resolve", "linked"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		expected := "found in PATH[0]; symlink resolved to " + testExe + " (--resolve)"
+		if !strings.Contains(stderr.String(), expected) {
+			t.Errorf("Expected %q, got %q", expected, stderr.String())
+		}
+	})
+
+	t.Run("off by default", func(t *testing.T) {
+		var stdout, stderr strings.Builder
+		if code := run([]string{"prog"}, nil, &stdout, &stderr); code != 0 {
+			t.Fatalf("Expected exit code 0, got %d (stderr: %s)", code, stderr.String())
+		}
+		if stderr.String() != "" {
+			t.Errorf("Expected no output on stderr, got %q", stderr.String())
+		}
+	})
+}